@@ -363,6 +363,19 @@ func (a *ASNReader) ReadBitString() ([]byte, errors.Error) {
 	return a.readStringBuffer()
 }
 
+func (a *ASNReader) ReadOctetString() ([]byte, errors.Error) {
+	offset := a.TopOffset()
+	tag, err := a.data.ReadByte()
+	if err != nil {
+		return nil, errors.New("Failed To read tag at offset %d. %s", offset, err)
+	}
+	if tag != EMBER_OCTETSTRING {
+		return nil, errors.New("Incorrect octet string tag at offset %d.", offset)
+	}
+
+	return a.readStringBuffer()
+}
+
 func (a *ASNReader) ReadReal() (float64, errors.Error) {
 	offset := a.TopOffset()
 	tag, err := a.data.ReadByte()
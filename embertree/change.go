@@ -0,0 +1,94 @@
+package embertree
+
+import (
+	"reflect"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// FieldChange describes the change of one contents field. Fields are named as in
+// the Ember+ specification (identifier, description, value, isOnline...). Values
+// are go types. OldValue is nil if the field was not set.
+type FieldChange struct {
+	Field    string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// ChangeEvent lists the changes applied to Element by an update. Element is nil
+// for the changes of the root.
+type ChangeEvent struct {
+	Element       *Element
+	Fields        []FieldChange
+	AddedChildren []*Element
+	// Connections received for a matrix, merged per target.
+	Connections []*Connection
+	// Received lists the parameter fields present in the update, changed or not.
+	Received []string
+}
+
+// ChangeListener is a Listener receiving the details of the changes. ReceiveChanges
+// is called instead of Receive when the element is updated, and only if something
+// changed. Receive is still used by the client to report errors such as timeouts.
+type ChangeListener interface {
+	Listener
+	ReceiveChanges(event *ChangeEvent, err errors.Error)
+}
+
+// UpdateListener is a Listener receiving the details of every update of the
+// element, including the updates changing nothing like the echo of a value.
+// ReceiveUpdate is called instead of Receive and ReceiveChanges.
+type UpdateListener interface {
+	Listener
+	ReceiveUpdate(event *ChangeEvent, err errors.Error)
+}
+
+// HasReceived returns true if field was present in the update.
+func (e *ChangeEvent) HasReceived(field string) bool {
+	for _, received := range e.Received {
+		if received == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty returns true if the event holds no change.
+func (e *ChangeEvent) IsEmpty() bool {
+	return len(e.Fields) == 0 && len(e.AddedChildren) == 0 && len(e.Connections) == 0
+}
+
+// GetFieldChange returns the change of field or nil if it did not change.
+func (e *ChangeEvent) GetFieldChange(field string) *FieldChange {
+	for i := range e.Fields {
+		if e.Fields[i].Field == field {
+			return &e.Fields[i]
+		}
+	}
+	return nil
+}
+
+// appendChange appends the change of field to changes if the values differ.
+func appendChange(changes []FieldChange, field string, oldValue interface{}, newValue interface{}) []FieldChange {
+	if reflect.DeepEqual(oldValue, newValue) {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, OldValue: oldValue, NewValue: newValue})
+}
+
+// notifyListeners calls the listeners of element with event.
+func notifyListeners(listeners []Listener, node interface{}, event *ChangeEvent, err errors.Error) {
+	for _, listener := range listeners {
+		if updateListener, ok := listener.(UpdateListener); ok {
+			updateListener.ReceiveUpdate(event, err)
+			continue
+		}
+		if changeListener, ok := listener.(ChangeListener); ok {
+			if err != nil || !event.IsEmpty() {
+				changeListener.ReceiveChanges(event, err)
+			}
+			continue
+		}
+		listener.Receive(node, err)
+	}
+}
@@ -0,0 +1,113 @@
+package embertree_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+type changeListener struct {
+	events   []*embertree.ChangeEvent
+	received int
+}
+
+func (l *changeListener) Receive(node interface{}, err errors.Error) {
+	l.received++
+}
+
+func (l *changeListener) ReceiveChanges(event *embertree.ChangeEvent, err errors.Error) {
+	l.events = append(l.events, event)
+}
+
+func decodeRoot(t *testing.T, tree *embertree.RootElement, root *embertree.RootElement) {
+	writer := asn1.NewASNWriter()
+	err := root.Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	err = tree.Decode(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+}
+
+func TestChangeEvents(t *testing.T) {
+	tree := embertree.NewTree()
+	node := embertree.NewNode(1)
+	node.CreateContent().(*embertree.NodeContents).SetIdentifier("gdnet")
+	tree.AddElement(node)
+	parameter := embertree.NewParameter(1)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.SetIdentifier("gain")
+	contents.GetValueObject().SetInt(0)
+	node.AddChild(parameter)
+	parameterListener := &changeListener{}
+	parameter.AddListener(parameterListener)
+	nodeListener := &changeListener{}
+	node.AddListener(nodeListener)
+
+	newValue := func(value int64) *embertree.RootElement {
+		update := embertree.NewQualifiedParameter(asn1.RelativeOID{1, 1})
+		update.CreateContent().(*embertree.ParameterContents).GetValueObject().SetInt(value)
+		root := embertree.NewRoot()
+		root.AddElement(update)
+		return root
+	}
+	decodeRoot(t, tree, newValue(5))
+	if len(parameterListener.events) != 1 {
+		t.Fatalf("Got %d events instead of 1", len(parameterListener.events))
+	}
+	event := parameterListener.events[0]
+	change := event.GetFieldChange("value")
+	if event.Element != parameter || len(event.Fields) != 1 || change == nil || change.OldValue != int64(0) || change.NewValue != int64(5) {
+		t.Errorf("Invalid value change %v", event.Fields)
+	}
+	decodeRoot(t, tree, newValue(5))
+	if len(parameterListener.events) != 1 || parameterListener.received != 0 {
+		t.Errorf("Change listener called without change")
+	}
+
+	child := embertree.NewQualifiedNode(asn1.RelativeOID{1, 2})
+	child.CreateContent().(*embertree.NodeContents).SetIdentifier("child")
+	root := embertree.NewRoot()
+	root.AddElement(child)
+	decodeRoot(t, tree, root)
+	if len(nodeListener.events) != 1 || len(nodeListener.events[0].AddedChildren) != 1 || nodeListener.events[0].AddedChildren[0].Number != 2 {
+		t.Errorf("Added child not reported")
+	}
+}
+
+type updateListener struct {
+	changeListener
+}
+
+func (l *updateListener) ReceiveUpdate(event *embertree.ChangeEvent, err errors.Error) {
+	l.events = append(l.events, event)
+}
+
+func TestUpdateListener(t *testing.T) {
+	tree := embertree.NewTree()
+	parameter := embertree.NewParameter(1)
+	parameter.CreateContent().(*embertree.ParameterContents).GetValueObject().SetInt(5)
+	tree.AddElement(parameter)
+	listener := &updateListener{}
+	parameter.AddListener(listener)
+
+	// The echo of an unchanged value is reported with the fields received.
+	update := embertree.NewQualifiedParameter(asn1.RelativeOID{1})
+	update.CreateContent().(*embertree.ParameterContents).GetValueObject().SetInt(5)
+	root := embertree.NewRoot()
+	root.AddElement(update)
+	decodeRoot(t, tree, root)
+	if len(listener.events) != 1 || listener.received != 0 {
+		t.Fatalf("Got %d updates instead of 1", len(listener.events))
+	}
+	event := listener.events[0]
+	if !event.IsEmpty() || !event.HasReceived("value") || event.HasReceived("identifier") {
+		t.Errorf("Invalid update %v received %v", event.Fields, event.Received)
+	}
+}
@@ -28,6 +28,7 @@ const (
 
 type CommandContents struct {
 	fieldFlags FieldFlags
+	invocation *Invocation
 }
 
 var CommandApplication = asn1.Application(2)
@@ -45,6 +46,21 @@ func NewCommand(number int) *Element {
 	return command
 }
 
+// NewInvokeCommand creates an invoke command carrying invocation.
+func NewInvokeCommand(invocation *Invocation) *Element {
+	command := NewCommand(COMMAND_INVOKE)
+	command.GetContent().(*CommandContents).invocation = invocation
+	return command
+}
+
+func (cc *CommandContents) SetInvocation(invocation *Invocation) {
+	cc.invocation = invocation
+}
+
+func (cc *CommandContents) GetInvocation() *Invocation {
+	return cc.invocation
+}
+
 func (cc *CommandContents) SetFieldFlags(fieldFlags FieldFlags) {
 	cc.fieldFlags = fieldFlags
 }
@@ -53,11 +69,36 @@ func (cc *CommandContents) GetFieldFlags() FieldFlags {
 	return cc.fieldFlags
 }
 
+// contentsContext returns the context of the command options. The field flags
+// use context 1 and the invocation context 2.
+func (cc *CommandContents) contentsContext() uint8 {
+	if cc.invocation != nil {
+		return asn1.Context(2)
+	}
+	return asn1.Context(1)
+}
+
 func (cc *CommandContents) Encode(writer *asn1.ASNWriter) errors.Error {
+	if cc.invocation != nil {
+		return cc.invocation.Encode(writer)
+	}
 	return writer.WriteInt(int(cc.fieldFlags))
 }
 
 func (cc *CommandContents) Decode(reader *asn1.ASNReader) errors.Error {
+	peek, err := reader.Peek()
+	if err != nil {
+		return errors.Update(err)
+	}
+	if peek == InvocationApplication {
+		invocation := &Invocation{}
+		err = invocation.Decode(reader)
+		if err != nil {
+			return errors.Update(err)
+		}
+		cc.invocation = invocation
+		return nil
+	}
 	val, err := reader.ReadInt()
 	if err != nil {
 		return err
@@ -67,6 +108,9 @@ func (cc *CommandContents) Decode(reader *asn1.ASNReader) errors.Error {
 }
 
 func (cc *CommandContents) ToString() string {
+	if cc.invocation != nil {
+		return fmt.Sprintf("  invocation: %d", cc.invocation.GetID())
+	}
 	switch cc.fieldFlags {
 	case ALLFieldFlags:
 		return fmt.Sprintf("  fieldFlags: ALL")
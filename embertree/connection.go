@@ -18,8 +18,8 @@ type ConnectionDisposition uint8
 const (
 	Tally    ConnectionDisposition = 0
 	Modified ConnectionDisposition = iota
-	Pending  ConnectionOperation   = iota
-	Locked   ConnectionOperation   = iota
+	Pending  ConnectionDisposition = iota
+	Locked   ConnectionDisposition = iota
 )
 
 type Connection struct {
@@ -31,6 +31,32 @@ type Connection struct {
 
 const ConnectionApplication = 16
 
+func NewConnection(target int32, sources []int32, operation ConnectionOperation) *Connection {
+	return &Connection{Target: target, Sources: sources, operation: operation}
+}
+
+// Copy returns a copy of the connection not sharing its sources.
+func (c *Connection) Copy() *Connection {
+	dup := *c
+	dup.Sources = append([]int32(nil), c.Sources...)
+	return &dup
+}
+
+func ConnectionDisposition2String(d ConnectionDisposition) string {
+	switch d {
+	case Tally:
+		return "tally"
+	case Modified:
+		return "modified"
+	case Pending:
+		return "pending"
+	case Locked:
+		return "locked"
+	default:
+		return "unknown"
+	}
+}
+
 func (c *Connection) SetDisposition(d int) errors.Error {
 	if d < int(Tally) || d > int(Locked) {
 		return errors.New("Invalid disposition %d.", d)
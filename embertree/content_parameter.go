@@ -149,6 +149,13 @@ func (cp *ContentParameter) Set(val *ContentParameter) errors.Error {
 		}
 		cp.SetReal(b)
 		break
+	case ValueTypeOID:
+		b, err := val.GetRelativeOID()
+		if err != nil {
+			return err
+		}
+		cp.SetRelativeOID(b)
+		break
 	}
 	return nil
 }
@@ -189,10 +196,43 @@ func (cp *ContentParameter) SetRelativeOID(val asn1.RelativeOID) {
 	cp.valueType = ValueTypeOID
 }
 
+// rawValue returns the value as a go type.
+func (cp *ContentParameter) rawValue() interface{} {
+	switch cp.valueType {
+	case ValueTypeBool:
+		return cp.boolVal
+	case ValueTypeString:
+		return cp.stringVal
+	case ValueTypeInteger:
+		return cp.intVal
+	case ValueTypeBuffer:
+		return cp.bufferVal
+	case ValueTypeReal:
+		return cp.realVal
+	case ValueTypeOID:
+		return cp.oid
+	}
+	return nil
+}
+
 func (cp *ContentParameter) IsSet() bool {
 	return cp.isSet
 }
 
+// mergeField overwrites cp with update if update is set and appends the change
+// of field to changes.
+func (cp *ContentParameter) mergeField(field string, update *ContentParameter, changes []FieldChange) []FieldChange {
+	if !update.isSet {
+		return changes
+	}
+	var oldValue interface{}
+	if cp.isSet {
+		oldValue = cp.rawValue()
+	}
+	*cp = *update
+	return appendChange(changes, field, oldValue, cp.rawValue())
+}
+
 func (cp *ContentParameter) GetString() (string, errors.Error) {
 	var err errors.Error = nil
 	if !cp.isSet {
@@ -278,7 +318,7 @@ func (cp *ContentParameter) Encode(context uint8, writer *asn1.ASNWriter) errors
 		if err != nil {
 			return errors.Update(err)
 		}
-		err = writer.WriteBuffer(b, asn1.EMBER_BITSTRING)
+		err = writer.WriteBuffer(b, asn1.EMBER_OCTETSTRING)
 		if err != nil {
 			return errors.Update(err)
 		}
@@ -372,8 +412,14 @@ func DecodeValue(reader *asn1.ASNReader, ctxt uint8) (*ContentParameter, errors.
 		}
 		contentParameter.SetBuffer(s)
 		break
+	case asn1.EMBER_OCTETSTRING:
+		s, err := pcReader.ReadOctetString()
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		contentParameter.SetBuffer(s)
+		break
 	case asn1.EMBER_STRING:
-		//case asn1.EMBER_OCTETSTRING:
 		s, err := pcReader.ReadString()
 		if err != nil {
 			return nil, errors.Update(err)
@@ -386,3 +432,117 @@ func DecodeValue(reader *asn1.ASNReader, ctxt uint8) (*ContentParameter, errors.
 	err = pcReader.ReadSequenceEnd()
 	return &contentParameter, errors.Update(err)
 }
+
+// ParameterType2ValueType returns the value type used to encode values of a parameter of type t.
+func ParameterType2ValueType(t ParameterType) ValueType {
+	switch t {
+	case ParameterTypeInteger, ParameterTypeTrigger, ParameterTypeEnum:
+		return ValueTypeInteger
+	case ParameterTypeReal:
+		return ValueTypeReal
+	case ParameterTypeString:
+		return ValueTypeString
+	case ParameterTypeBoolean:
+		return ValueTypeBool
+	case ParameterTypeOcets:
+		return ValueTypeBuffer
+	default:
+		return ValueTypeUnset
+	}
+}
+
+// NewValue converts a go value into a ContentParameter of the requested type.
+// With ValueTypeUnset, the type is derived from the go type of value.
+func NewValue(value interface{}, valueType ValueType) (*ContentParameter, errors.Error) {
+	cp := NewContentParameter()
+	switch v := value.(type) {
+	case *ContentParameter:
+		if !v.IsSet() {
+			return nil, errors.New("Parameter not set")
+		}
+		return NewValue(v.rawValue(), valueType)
+	case bool:
+		if valueType != ValueTypeUnset && valueType != ValueTypeBool {
+			break
+		}
+		cp.SetBool(v)
+		return cp, nil
+	case string:
+		if valueType != ValueTypeUnset && valueType != ValueTypeString {
+			break
+		}
+		cp.SetString(v)
+		return cp, nil
+	case []byte:
+		if valueType != ValueTypeUnset && valueType != ValueTypeBuffer {
+			break
+		}
+		cp.SetBuffer(v)
+		return cp, nil
+	case asn1.RelativeOID:
+		if valueType != ValueTypeUnset && valueType != ValueTypeOID {
+			break
+		}
+		cp.SetRelativeOID(v)
+		return cp, nil
+	case float32:
+		return newRealValue(cp, float64(v), valueType)
+	case float64:
+		return newRealValue(cp, v, valueType)
+	default:
+		i, ok := toInt64(value)
+		if !ok {
+			break
+		}
+		switch valueType {
+		case ValueTypeUnset, ValueTypeInteger:
+			cp.SetInt(i)
+			return cp, nil
+		case ValueTypeReal:
+			cp.SetReal(float64(i))
+			return cp, nil
+		}
+	}
+	return nil, errors.New("Can't convert %v to %s.", value, ValueType2String(valueType))
+}
+
+func newRealValue(cp *ContentParameter, value float64, valueType ValueType) (*ContentParameter, errors.Error) {
+	switch valueType {
+	case ValueTypeUnset, ValueTypeReal:
+		cp.SetReal(value)
+	case ValueTypeInteger:
+		if value != float64(int64(value)) {
+			return nil, errors.New("Can't convert %f to integer.", value)
+		}
+		cp.SetInt(int64(value))
+	default:
+		return nil, errors.New("Can't convert %f to %s.", value, ValueType2String(valueType))
+	}
+	return cp, nil
+}
+
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
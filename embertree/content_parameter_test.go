@@ -195,3 +195,69 @@ func TestContentParameterEncodeDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestNewValue(t *testing.T) {
+	cp, err := embertree.NewValue(12, embertree.ValueTypeUnset)
+	if err != nil || cp.GetType() != embertree.ValueTypeInteger {
+		t.Fatalf("Invalid integer value")
+	}
+	cp, err = embertree.NewValue(12, embertree.ValueTypeReal)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	r, err := cp.GetReal()
+	if err != nil || r != 12 {
+		t.Errorf("Integer not converted to real")
+	}
+	cp, err = embertree.NewValue(3.0, embertree.ValueTypeInteger)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	i, err := cp.GetInt()
+	if err != nil || i != 3 {
+		t.Errorf("Real not converted to integer")
+	}
+	_, err = embertree.NewValue(3.5, embertree.ValueTypeInteger)
+	if err == nil {
+		t.Errorf("Expected error converting 3.5 to integer")
+	}
+	_, err = embertree.NewValue("abc", embertree.ValueTypeBool)
+	if err == nil {
+		t.Errorf("Expected error converting string to bool")
+	}
+}
+
+func TestGetSetValueMsg(t *testing.T) {
+	node := embertree.NewNode(1)
+	node.CreateContent()
+	parameter := embertree.NewParameter(2)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.GetValueObject().SetReal(1.5)
+	node.AddChild(parameter)
+	msg, err := parameter.GetSetValueMsg(2)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	writer := asn1.ASNWriter{}
+	err = msg.Encode(&writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	buffer := make([]byte, writer.Len())
+	writer.Read(buffer)
+	elements, err := embertree.DecodeRootElementCollection(asn1.NewASNReader(buffer))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if len(elements) != 1 || elements[0].GetTag() != embertree.QualifiedParameterApplication {
+		t.Fatal("Expected a single qualified parameter")
+	}
+	value, err := elements[0].GetContent().(*embertree.ParameterContents).GetValueObject().GetReal()
+	if err != nil || value != 2 {
+		t.Errorf("Invalid value encoded")
+	}
+	_, err = node.GetSetValueMsg(2)
+	if err == nil {
+		t.Errorf("Expected error setting a value on a node")
+	}
+}
@@ -0,0 +1,152 @@
+package embertree
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// unitSeparator separates the printf part of an Ember+ format from the units.
+const unitSeparator = "°"
+
+// displayUnits returns text with the unit separator shown as a space.
+func displayUnits(text string) string {
+	return strings.Replace(text, unitSeparator, " ", 1)
+}
+
+// splitFormat returns the text before the first verb of a printf like format,
+// the verb with its flags, width and precision, and the text after it. The
+// verb is empty when format has none.
+func splitFormat(format string) (string, string, string) {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			i++
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			break
+		}
+		unescape := func(text string) string { return strings.Replace(text, "%%", "%", -1) }
+		return unescape(format[:i]), format[i : j+1], unescape(format[j+1:])
+	}
+	return strings.Replace(format, "%%", "%", -1), "", ""
+}
+
+// isEnum returns true for enum parameters, or parameters without type holding
+// enum entries.
+func (contents *ParameterContents) isEnum() bool {
+	ptype, err := contents.GetType()
+	if err == nil {
+		return ptype == ParameterTypeEnum
+	}
+	_, err = contents.GetEnumEntries()
+	return err == nil
+}
+
+// FormatValue returns the value as shown to operators. Enum values are replaced
+// by their name. Numeric values go through the formula or the factor, then the
+// format and its units. "%.1f°dB" shows as "-6.2 dB".
+func (contents *ParameterContents) FormatValue() (string, errors.Error) {
+	value := contents.GetValueObject()
+	if !value.IsSet() {
+		return "", errors.New("Parameter has no value.")
+	}
+	if contents.isEnum() {
+		return contents.GetValueName()
+	}
+	format, err := contents.GetFormat()
+	if err != nil {
+		format = ""
+	}
+	prefix, verb, suffix := splitFormat(displayUnits(format))
+	display, err := contents.GetDisplayValue()
+	if err != nil {
+		if _, ok := numericValue(value); ok {
+			return "", errors.Update(err)
+		}
+		// Strings, booleans and buffers only get the units.
+		if verb == "" {
+			return value.ToString() + prefix, nil
+		}
+		return prefix + value.ToString() + suffix, nil
+	}
+	if verb == "" {
+		return strconv.FormatFloat(display, 'f', -1, 64) + prefix, nil
+	}
+	var text string
+	switch verb[len(verb)-1] {
+	case 'd', 'x', 'X', 'o', 'b', 'c':
+		text = fmt.Sprintf(verb, int64(math.Round(display)))
+	case 'e', 'E', 'f', 'F', 'g', 'G':
+		text = fmt.Sprintf(verb, display)
+	default:
+		text = strconv.FormatFloat(display, 'f', -1, 64)
+	}
+	return prefix + text + suffix, nil
+}
+
+// ParseDisplayValue converts text formatted like FormatValue does back to a
+// value of the parameter type. The units of the format are optional and may be
+// separated by a space or by the unit separator.
+func (contents *ParameterContents) ParseDisplayValue(text string) (*ContentParameter, errors.Error) {
+	text = strings.TrimSpace(text)
+	if contents.isEnum() {
+		entries, err := contents.GetEnumEntries()
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		for _, entry := range entries {
+			if entry.Name == text {
+				return NewValue(entry.Value, ValueTypeInteger)
+			}
+		}
+		return nil, errors.New("Unknown enum entry %s.", text)
+	}
+	format, err := contents.GetFormat()
+	if err == nil {
+		prefix, verb, suffix := splitFormat(format)
+		if verb == "" {
+			suffix = prefix
+			prefix = ""
+		}
+		text = trimUnits(text, prefix, strings.HasPrefix, strings.TrimPrefix)
+		text = trimUnits(text, suffix, strings.HasSuffix, strings.TrimSuffix)
+	}
+	valueType := contents.GetValueType()
+	switch valueType {
+	case ValueTypeInteger, ValueTypeReal:
+		display, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, errors.New("Invalid number %s.", text)
+		}
+		return contents.DisplayToValue(display)
+	case ValueTypeBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, errors.New("Invalid boolean %s.", text)
+		}
+		return NewValue(b, valueType)
+	}
+	return NewValue(text, valueType)
+}
+
+// trimUnits removes units from text, written with the unit separator or with a
+// space.
+func trimUnits(text string, units string, has func(string, string) bool, trim func(string, string) string) string {
+	for _, form := range []string{units, displayUnits(units)} {
+		if form = strings.TrimSpace(form); form != "" && has(text, form) {
+			return strings.TrimSpace(trim(text, form))
+		}
+	}
+	return text
+}
@@ -0,0 +1,103 @@
+package embertree_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func newDisplayTestParameter(ptype embertree.ParameterType, format string) *embertree.ParameterContents {
+	contents := embertree.NewParameterContents().(*embertree.ParameterContents)
+	contents.SetType(ptype)
+	if format != "" {
+		contents.SetFormat(format)
+	}
+	return contents
+}
+
+func TestFormatValue(t *testing.T) {
+	gain := newDisplayTestParameter(embertree.ParameterTypeInteger, "%.1f°dB")
+	gain.SetFactor(32)
+	gain.GetValueObject().SetInt(-200)
+	level := newDisplayTestParameter(embertree.ParameterTypeReal, "%5.2f %%")
+	level.GetValueObject().SetReal(42.125)
+	count := newDisplayTestParameter(embertree.ParameterTypeInteger, "")
+	count.GetValueObject().SetInt(12)
+	mode := newDisplayTestParameter(embertree.ParameterTypeEnum, "")
+	mode.SetEnumeration("Mono\nStereo")
+	mode.GetValueObject().SetInt(1)
+	name := newDisplayTestParameter(embertree.ParameterTypeString, "")
+	name.GetValueObject().SetString("Mic 1")
+	delay := newDisplayTestParameter(embertree.ParameterTypeString, "°ms")
+	delay.GetValueObject().SetString("auto")
+
+	tests := []struct {
+		contents *embertree.ParameterContents
+		expected string
+	}{
+		{gain, "-6.2 dB"},
+		{level, "42.12 %"},
+		{count, "12"},
+		{mode, "Stereo"},
+		{name, "Mic 1"},
+		{delay, "auto ms"},
+	}
+	for i, test := range tests {
+		text, err := test.contents.FormatValue()
+		if err != nil {
+			t.Errorf("Failed to format value %d. %s", i, err.Message)
+			continue
+		}
+		if text != test.expected {
+			t.Errorf("Value %d formatted as %q instead of %q", i, text, test.expected)
+		}
+	}
+}
+
+func TestParseDisplayValue(t *testing.T) {
+	gain := newDisplayTestParameter(embertree.ParameterTypeInteger, "%.1f°dB")
+	gain.SetFactor(32)
+	value, err := gain.ParseDisplayValue("-6.25°dB")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != -200 {
+		t.Errorf("Unexpected gain %d", i)
+	}
+	value, err = gain.ParseDisplayValue("-6.25 dB")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != -200 {
+		t.Errorf("Unexpected gain %d", i)
+	}
+	value, err = gain.ParseDisplayValue(" 1.5 ")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != 48 {
+		t.Errorf("Unexpected gain %d", i)
+	}
+	if _, err = gain.ParseDisplayValue("loud"); err == nil {
+		t.Error("Expected an error parsing a value not a number")
+	}
+
+	mode := newDisplayTestParameter(embertree.ParameterTypeEnum, "")
+	mode.SetEnumeration("Mono\nStereo")
+	value, err = mode.ParseDisplayValue("Stereo")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != 1 {
+		t.Errorf("Unexpected mode %d", i)
+	}
+
+	level := newDisplayTestParameter(embertree.ParameterTypeReal, "%5.2f %%")
+	value, err = level.ParseDisplayValue("42.5 %")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if r, _ := value.GetReal(); r != 42.5 {
+		t.Errorf("Unexpected level %g", r)
+	}
+}
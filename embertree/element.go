@@ -2,6 +2,7 @@ package embertree
 
 import (
 	"fmt"
+	"sync"
 
 	. "github.com/dufourgilles/emberlib/logger"
 	"github.com/dufourgilles/emberlib/asn1"
@@ -25,6 +26,30 @@ type EmberObject interface {
 	GetTag() uint8
 }
 
+// contentsMerger is implemented by the contents supporting sparse updates.
+// merge returns the changes or false if update is not of the same type.
+type contentsMerger interface {
+	merge(update EmberContents) ([]FieldChange, bool)
+}
+
+// newEmptyContents returns empty contents of the same type as contents, or nil
+// if they can't be merged.
+func newEmptyContents(contents EmberContents) EmberContents {
+	switch contents.(type) {
+	case *ParameterContents:
+		return &ParameterContents{}
+	case *NodeContents:
+		return &NodeContents{}
+	case *MatrixContent:
+		return &MatrixContent{}
+	case *FunctionContents:
+		return &FunctionContents{}
+	case *TemplateContents:
+		return &TemplateContents{}
+	}
+	return nil
+}
+
 type Listener interface {
 	Receive(interface{}, errors.Error)
 }
@@ -40,9 +65,12 @@ type Element struct {
 	path            asn1.RelativeOID
 	Children        map[int]*Element
 	parent          *Element
+	// root is only set on the elements at the top of a tree.
+	root            *RootElement
 	contents        EmberContents
 	contentsCreator ContentCreator
 	listeners       map[Listener]Listener
+	listenersLock   sync.Mutex
 	logger Logger
 	// for qualified element
 	isQualified bool
@@ -83,17 +111,63 @@ func (element *Element) CreateContent() interface{} {
 }
 
 func (element *Element) AddListener(listener Listener) {
+	element.listenersLock.Lock()
+	defer element.listenersLock.Unlock()
 	element.listeners[listener] = listener
 }
 
 func (element *Element) RemoveListener(listener Listener) {
+	element.listenersLock.Lock()
+	defer element.listenersLock.Unlock()
 	delete(element.listeners, listener)
 }
 
+// getListeners returns a copy of the listeners so they can add or remove
+// listeners when called.
+func (element *Element) getListeners() []Listener {
+	element.listenersLock.Lock()
+	defer element.listenersLock.Unlock()
+	listeners := make([]Listener, 0, len(element.listeners))
+	for _, listener := range element.listeners {
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
 func (element *Element) GetContent() EmberContents {
 	return element.contents
 }
 
+// identifiedContents is implemented by the contents holding an identifier.
+type identifiedContents interface {
+	GetIdentifier() (string, errors.Error)
+}
+
+// GetIdentifier returns the identifier from the node, parameter, matrix or
+// function contents.
+func (element *Element) GetIdentifier() (string, errors.Error) {
+	contents, ok := element.contents.(identifiedContents)
+	if !ok {
+		return "", errors.New("Element %s has no identifier.", Path2String(element.GetPath()))
+	}
+	return contents.GetIdentifier()
+}
+
+// getChildByIdentifier returns the child of children with identifier or nil.
+func getChildByIdentifier(children map[int]*Element, identifier string) *Element {
+	for _, child := range children {
+		if id, err := child.GetIdentifier(); err == nil && id == identifier {
+			return child
+		}
+	}
+	return nil
+}
+
+// GetChildByIdentifier returns the child with identifier or nil.
+func (element *Element) GetChildByIdentifier(identifier string) *Element {
+	return getChildByIdentifier(element.Children, identifier)
+}
+
 func (element *Element) GetTag() uint8 {
 	return element.tag
 }
@@ -101,33 +175,83 @@ func (element *Element) GetTag() uint8 {
 func (element *Element) AddChild(child *Element) errors.Error {
 	element.Children[child.Number] = child
 	child.SetParent(element)
+	if root := element.getRoot(); root != nil {
+		root.indexElement(child, true)
+	}
 	return nil
 }
 
-func (element *Element) updateListeners(err errors.Error) {
-	for _, listener := range element.listeners {
-		listener.Receive(element, err)
+// getRoot returns the tree element belongs to or nil.
+func (element *Element) getRoot() *RootElement {
+	for element.parent != nil {
+		element = element.parent
 	}
+	return element.root
+}
+
+func (element *Element) updateListeners(event *ChangeEvent, err errors.Error) {
+	notifyListeners(element.getListeners(), element, event, err)
 }
+
 func (element *Element) SetContents(contents interface{}) errors.Error {
+	event := &ChangeEvent{Element: element}
+	event.Fields = appendChange(nil, "contents", element.contents, contents)
 	element.contents = contents.(EmberContents)
-	element.updateListeners(nil)
+	if root := element.getRoot(); root != nil {
+		root.indexElement(element, false)
+	}
+	element.updateListeners(event, nil)
 	return nil
 }
 
 func (element *Element) Update(newElement *Element) errors.Error {
 	var err errors.Error
-	if element.Number != newElement.Number || element.tag != newElement.tag {
+	if element.Number != newElement.Number || GetUnqualifiedTag(element.tag) != GetUnqualifiedTag(newElement.tag) {
 		return errors.New("Attempt to update different element Number %d/%d Tag %d/%d", element.Number, newElement.Number, element.tag, newElement.tag)
 	}
+	event := &ChangeEvent{Element: element}
 	content := newElement.GetContent()
+	if parameter, ok := content.(*ParameterContents); ok {
+		event.Received = parameter.receivedFields()
+	}
 	if content != nil {
-		element.contents = content.(EmberContents)
+		// Providers usually only send the modified fields.
+		current := element.contents
+		if current == nil {
+			current = newEmptyContents(content)
+		}
+		merged := false
+		if merger, ok := current.(contentsMerger); ok {
+			event.Fields, merged = merger.merge(content)
+		}
+		if merged {
+			element.contents = current
+		} else {
+			event.Fields = appendChange(nil, "contents", element.contents, content)
+			element.contents = content
+		}
+		// Indexed before the children so they get the new identifier path.
+		if root := element.getRoot(); root != nil {
+			root.indexElement(element, false)
+		}
+	}
+	if element.isMatrix {
+		if len(newElement.targets) > 0 {
+			event.Fields = appendChange(event.Fields, "targets", element.targets, newElement.targets)
+			element.targets = newElement.targets
+		}
+		if len(newElement.sources) > 0 {
+			event.Fields = appendChange(event.Fields, "sources", element.sources, newElement.sources)
+			element.sources = newElement.sources
+		}
+		element.mergeConnections(newElement.connections)
+		event.Connections = newElement.connections
 	}
 	for number, newChild := range newElement.Children {
 		child := element.Children[number]
 		if child == nil {
 			err = element.AddChild(newChild)
+			event.AddedChildren = append(event.AddedChildren, newChild)
 		} else {
 			err = child.Update(newChild)
 		}
@@ -135,7 +259,7 @@ func (element *Element) Update(newElement *Element) errors.Error {
 			break
 		}
 	}
-	element.updateListeners(err)
+	element.updateListeners(event, err)
 	return err
 }
 
@@ -191,8 +315,17 @@ func (element *Element) encode(writer *asn1.ASNWriter, asChild bool) errors.Erro
 		}
 	}
 	// Encode Contents
-	if element.contents != nil {
-		err = writer.StartSequence(asn1.Context(1))
+	if template, ok := element.contents.(*TemplateContents); ok {
+		err = template.Encode(writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+	} else if element.contents != nil {
+		contentsCtx := asn1.Context(1)
+		if command, ok := element.contents.(*CommandContents); ok {
+			contentsCtx = command.contentsContext()
+		}
+		err = writer.StartSequence(contentsCtx)
 		if err != nil {
 			return errors.Update(err)
 		}
@@ -225,17 +358,23 @@ func (element *Element) encode(writer *asn1.ASNWriter, asChild bool) errors.Erro
 	}
 
 	if element.isMatrix {
-		err = element.EncodeTargets(writer)
-		if err != nil {
-			return errors.Update(err)
+		if len(element.targets) > 0 {
+			err = element.EncodeTargets(writer)
+			if err != nil {
+				return errors.Update(err)
+			}
 		}
-		err = element.EncodeSources(writer)
-		if err != nil {
-			return errors.Update(err)
+		if len(element.sources) > 0 {
+			err = element.EncodeSources(writer)
+			if err != nil {
+				return errors.Update(err)
+			}
 		}
-		err = element.EncodeConnections(writer)
-		if err != nil {
-			return errors.Update(err)
+		if len(element.connections) > 0 {
+			err = element.EncodeConnections(writer)
+			if err != nil {
+				return errors.Update(err)
+			}
 		}
 	}
 
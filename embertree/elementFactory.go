@@ -21,8 +21,14 @@ func getContentCreator(tag uint8) (ContentCreator, errors.Error) {
 		fallthrough
 	case MatrixApplication:
 		return NewDefaultMatrixContents, nil
+	case QualifiedFunctionApplication:
+		fallthrough
 	case FunctionApplication:
 		return NewFunctionContents, nil
+	case QualifiedTemplateApplication:
+		fallthrough
+	case TemplateApplication:
+		return NewTemplateContents, nil
 	default:
 		return nil, errors.New("Unknown Application %d.", tag)
 	}
@@ -161,12 +167,21 @@ func DecodeElement(reader *asn1.ASNReader) (*Element, errors.Error) {
 	} else {
 		element = NewElement(tag, number, contentCreator)
 	}
+	if element.IsTemplate() {
+		tcontents := NewTemplateContents().(*TemplateContents)
+		err = tcontents.Decode(elementReader)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		element.SetContents(tcontents)
+		return element, nil
+	}
 	for elementReader.Len() > 0 {
 		b, err := elementReader.Peek()
 		if err != nil {
 			return nil, errors.Update(err)
 		}
-		if b == asn1.Context(1) {
+		if b == asn1.Context(1) || (b == asn1.Context(2) && tag == CommandApplication) {
 			contents, err = decodeContents(element, b, elementReader)
 			if err != nil {
 				return nil, errors.Update(err)
@@ -0,0 +1,229 @@
+package embertree
+
+import (
+	"strings"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+var StringIntegerPairApplication = asn1.Application(7)
+var StringIntegerCollectionApplication = asn1.Application(8)
+
+// hiddenEnumPrefix marks the entries not to be shown to operators.
+const hiddenEnumPrefix = "~"
+
+// EnumEntry is a named value of an enum parameter.
+type EnumEntry struct {
+	Name   string
+	Value  int64
+	Hidden bool
+}
+
+func newEnumEntry(name string, value int64) EnumEntry {
+	if strings.HasPrefix(name, hiddenEnumPrefix) {
+		return EnumEntry{Name: name[len(hiddenEnumPrefix):], Value: value, Hidden: true}
+	}
+	return EnumEntry{Name: name, Value: value}
+}
+
+func (entry EnumEntry) encodedName() string {
+	if entry.Hidden {
+		return hiddenEnumPrefix + entry.Name
+	}
+	return entry.Name
+}
+
+// ParseEnumeration splits a newline separated enumeration string. The value of
+// each entry is its line number, starting at 0.
+func ParseEnumeration(enumeration string) []EnumEntry {
+	lines := strings.Split(enumeration, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	entries := make([]EnumEntry, len(lines))
+	for i, line := range lines {
+		entries[i] = newEnumEntry(strings.TrimSuffix(line, "\r"), int64(i))
+	}
+	return entries
+}
+
+func encodeEnumMap(entries []EnumEntry, writer *asn1.ASNWriter) errors.Error {
+	err := writer.StartSequence(StringIntegerCollectionApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	for _, entry := range entries {
+		err = writer.StartSequence(asn1.Context(0))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.StartSequence(StringIntegerPairApplication)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.StartSequence(asn1.Context(0))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.WriteString(entry.encodedName())
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.StartSequence(asn1.Context(1))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.WriteInt64(entry.Value)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return writer.EndSequence()
+}
+
+func decodeEnumPair(reader *asn1.ASNReader) (EnumEntry, errors.Error) {
+	var (
+		name  string
+		value int64
+	)
+	_, pairReader, err := reader.ReadSequenceStart(StringIntegerPairApplication)
+	if err != nil {
+		return EnumEntry{}, errors.Update(err)
+	}
+	for pairReader.Len() > 0 {
+		peek, err := pairReader.Peek()
+		if err != nil {
+			return EnumEntry{}, errors.Update(err)
+		}
+		_, ctxtReader, err := pairReader.ReadSequenceStart(peek)
+		if err != nil {
+			return EnumEntry{}, errors.Update(err)
+		}
+		switch peek {
+		case asn1.Context(0):
+			name, err = ctxtReader.ReadString()
+		case asn1.Context(1):
+			value, err = ctxtReader.ReadInt64()
+		default:
+			err = errors.New("Unknown enum entry tag 0x%x at offset %d.", peek, pairReader.TopOffset())
+		}
+		if err != nil {
+			return EnumEntry{}, errors.Update(err)
+		}
+		err = ctxtReader.ReadSequenceEnd()
+		if err != nil {
+			return EnumEntry{}, errors.Update(err)
+		}
+		end, err := pairReader.CheckSequenceEnd()
+		if end {
+			break
+		}
+		if err != nil {
+			return EnumEntry{}, errors.Update(err)
+		}
+	}
+	return newEnumEntry(name, value), nil
+}
+
+func decodeEnumMap(reader *asn1.ASNReader) ([]EnumEntry, errors.Error) {
+	entries := []EnumEntry{}
+	_, collectionReader, err := reader.ReadSequenceStart(StringIntegerCollectionApplication)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	for collectionReader.Len() > 0 {
+		_, entryReader, err := collectionReader.ReadSequenceStart(asn1.Context(0))
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		entry, err := decodeEnumPair(entryReader)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		entries = append(entries, entry)
+		err = entryReader.ReadSequenceEnd()
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		end, err := collectionReader.CheckSequenceEnd()
+		if end {
+			break
+		}
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	}
+	return entries, nil
+}
+
+func (contents *ParameterContents) SetEnumMap(entries []EnumEntry) {
+	contents.enumMap = entries
+}
+
+// GetEnumMap returns the entries of the enum map or nil if the parameter has none.
+func (contents *ParameterContents) GetEnumMap() []EnumEntry {
+	return contents.enumMap
+}
+
+// GetEnumEntries returns the entries of the enum map or, when missing, the ones
+// of the enumeration string.
+func (contents *ParameterContents) GetEnumEntries() ([]EnumEntry, errors.Error) {
+	if contents.enumMap != nil {
+		return contents.enumMap, nil
+	}
+	enumeration, err := contents.GetEnumeration()
+	if err != nil {
+		return nil, errors.New("Parameter has neither an enum map nor an enumeration.")
+	}
+	return ParseEnumeration(enumeration), nil
+}
+
+// GetValueName returns the name of the entry matching the current value.
+func (contents *ParameterContents) GetValueName() (string, errors.Error) {
+	value, err := contents.table[valueCtx].GetInt()
+	if err != nil {
+		return "", errors.Update(err)
+	}
+	entries, err := contents.GetEnumEntries()
+	if err != nil {
+		return "", errors.Update(err)
+	}
+	for _, entry := range entries {
+		if entry.Value == value {
+			return entry.Name, nil
+		}
+	}
+	return "", errors.New("No enum entry for value %d.", value)
+}
+
+// SetValueByName sets the value to the one of the entry called name.
+func (contents *ParameterContents) SetValueByName(name string) errors.Error {
+	entries, err := contents.GetEnumEntries()
+	if err != nil {
+		return errors.Update(err)
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			contents.table[valueCtx].SetInt(entry.Value)
+			return nil
+		}
+	}
+	return errors.New("Unknown enum entry %s.", name)
+}
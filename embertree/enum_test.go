@@ -0,0 +1,74 @@
+package embertree_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func TestParseEnumeration(t *testing.T) {
+	entries := embertree.ParseEnumeration("Off\n~Test\nOn\n")
+	expected := []embertree.EnumEntry{
+		{Name: "Off", Value: 0},
+		{Name: "Test", Value: 1, Hidden: true},
+		{Name: "On", Value: 2},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+}
+
+func TestEnumMapDecode(t *testing.T) {
+	message := embertree.NewRoot()
+	parameter := embertree.NewParameter(1)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.SetIdentifier("mode")
+	contents.SetEnumMap([]embertree.EnumEntry{
+		{Name: "Mono", Value: 1},
+		{Name: "Service", Value: 5, Hidden: true},
+		{Name: "Stereo", Value: 2},
+	})
+	contents.GetValueObject().SetInt(2)
+	message.AddElement(parameter)
+
+	tree := embertree.NewTree()
+	decodeRoot(t, tree, message)
+	_, element := tree.GetElementByPath(asn1.RelativeOID{1})
+	decoded := element.GetContent().(*embertree.ParameterContents)
+	entries, err := decoded.GetEnumEntries()
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !reflect.DeepEqual(entries, contents.GetEnumMap()) {
+		t.Errorf("Unexpected enum map %v", entries)
+	}
+	name, err := decoded.GetValueName()
+	if err != nil || name != "Stereo" {
+		t.Errorf("Unexpected value name %s", name)
+	}
+	err = decoded.SetValueByName("Service")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if value, _ := decoded.GetValueObject().GetInt(); value != 5 {
+		t.Errorf("Unexpected value %d", value)
+	}
+	if err = decoded.SetValueByName("Surround"); err == nil {
+		t.Error("Expected an error for an unknown entry")
+	}
+}
+
+func TestEnumerationValueName(t *testing.T) {
+	contents := embertree.NewParameterContents().(*embertree.ParameterContents)
+	if _, err := contents.GetEnumEntries(); err == nil {
+		t.Error("Expected an error without enumeration")
+	}
+	contents.SetEnumeration("Off\nOn")
+	contents.GetValueObject().SetInt(1)
+	name, err := contents.GetValueName()
+	if err != nil || name != "On" {
+		t.Errorf("Unexpected value name %s", name)
+	}
+}
@@ -0,0 +1,395 @@
+package embertree
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// formulaNode evaluates a compiled expression for the value of $.
+type formulaNode func(value float64) float64
+
+type formulaFunction struct {
+	arity int
+	call  func(args []float64) float64
+}
+
+func unaryFunction(f func(float64) float64) formulaFunction {
+	return formulaFunction{arity: 1, call: func(args []float64) float64 { return f(args[0]) }}
+}
+
+func binaryFunction(f func(float64, float64) float64) formulaFunction {
+	return formulaFunction{arity: 2, call: func(args []float64) float64 { return f(args[0], args[1]) }}
+}
+
+var formulaFunctions = map[string]formulaFunction{
+	"abs":   unaryFunction(math.Abs),
+	"sqrt":  unaryFunction(math.Sqrt),
+	"exp":   unaryFunction(math.Exp),
+	"ln":    unaryFunction(math.Log),
+	"log":   unaryFunction(math.Log10),
+	"log2":  unaryFunction(math.Log2),
+	"sin":   unaryFunction(math.Sin),
+	"cos":   unaryFunction(math.Cos),
+	"tan":   unaryFunction(math.Tan),
+	"asin":  unaryFunction(math.Asin),
+	"acos":  unaryFunction(math.Acos),
+	"atan":  unaryFunction(math.Atan),
+	"ceil":  unaryFunction(math.Ceil),
+	"floor": unaryFunction(math.Floor),
+	"round": unaryFunction(math.Round),
+	"trunc": unaryFunction(math.Trunc),
+	"pow":   binaryFunction(math.Pow),
+	"min":   binaryFunction(math.Min),
+	"max":   binaryFunction(math.Max),
+}
+
+var formulaConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// Formula converts parameter values between the provider and the consumer
+// representations. The Ember+ formula holds the provider to consumer expression
+// and the consumer to provider expression on two lines. $ is the value to
+// convert.
+//
+// Expressions support numbers, $, the constants pi and e, the operators + - * /
+// % and ^ (power), parentheses and the functions abs, sqrt, exp, ln, log (base
+// 10), log2, sin, cos, tan, asin, acos, atan, ceil, floor, round, trunc, pow, min
+// and max.
+type Formula struct {
+	providerToConsumer formulaNode
+	consumerToProvider formulaNode
+}
+
+// ParseFormula compiles formula. Either expression can be empty, converting in
+// that direction then fails.
+func ParseFormula(formula string) (*Formula, errors.Error) {
+	lines := strings.SplitN(formula, "\n", 2)
+	f := &Formula{}
+	var err errors.Error
+	if expression := strings.TrimSpace(lines[0]); expression != "" {
+		f.providerToConsumer, err = compileFormula(expression)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	}
+	if len(lines) > 1 {
+		if expression := strings.TrimSpace(lines[1]); expression != "" {
+			f.consumerToProvider, err = compileFormula(expression)
+			if err != nil {
+				return nil, errors.Update(err)
+			}
+		}
+	}
+	return f, nil
+}
+
+// ToConsumer converts a provider value to the value displayed to the consumer.
+func (f *Formula) ToConsumer(value float64) (float64, errors.Error) {
+	if f.providerToConsumer == nil {
+		return 0, errors.New("Formula has no provider to consumer expression.")
+	}
+	return evaluateFormula(f.providerToConsumer, value)
+}
+
+// ToProvider converts a consumer value back to the provider value.
+func (f *Formula) ToProvider(value float64) (float64, errors.Error) {
+	if f.consumerToProvider == nil {
+		return 0, errors.New("Formula has no consumer to provider expression.")
+	}
+	return evaluateFormula(f.consumerToProvider, value)
+}
+
+func evaluateFormula(node formulaNode, value float64) (float64, errors.Error) {
+	result := node(value)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, errors.New("Formula result for %g is not a number.", value)
+	}
+	return result, nil
+}
+
+// formulaParser is a recursive descent parser of one expression.
+//
+//	expression := term (("+" | "-") term)*
+//	term       := unary (("*" | "/" | "%") unary)*
+//	unary      := ("-" | "+") unary | power
+//	power      := primary ("^" unary)?
+//	primary    := number | "$" | constant | function "(" arguments ")" | "(" expression ")"
+type formulaParser struct {
+	expression []rune
+	pos        int
+}
+
+func compileFormula(expression string) (formulaNode, errors.Error) {
+	p := &formulaParser{expression: []rune(expression)}
+	node, err := p.parseExpression()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	if p.peek() != 0 {
+		return nil, p.error("Unexpected '%c'.", p.peek())
+	}
+	return node, nil
+}
+
+func (p *formulaParser) error(format string, args ...interface{}) errors.Error {
+	err := errors.New(format, args...)
+	return errors.New("Invalid formula \"%s\" at %d. %s", string(p.expression), p.pos, err.Message)
+}
+
+// peek returns the next non space character or 0 at the end.
+func (p *formulaParser) peek() rune {
+	for p.pos < len(p.expression) && unicode.IsSpace(p.expression[p.pos]) {
+		p.pos++
+	}
+	if p.pos >= len(p.expression) {
+		return 0
+	}
+	return p.expression[p.pos]
+}
+
+func (p *formulaParser) parseExpression() (formulaNode, errors.Error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		if operator != '+' && operator != '-' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		if operator == '+' {
+			left = func(v float64) float64 { return l(v) + right(v) }
+		} else {
+			left = func(v float64) float64 { return l(v) - right(v) }
+		}
+	}
+}
+
+func (p *formulaParser) parseTerm() (formulaNode, errors.Error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		if operator != '*' && operator != '/' && operator != '%' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		switch operator {
+		case '*':
+			left = func(v float64) float64 { return l(v) * right(v) }
+		case '/':
+			left = func(v float64) float64 { return l(v) / right(v) }
+		default:
+			left = func(v float64) float64 { return math.Mod(l(v), right(v)) }
+		}
+	}
+}
+
+func (p *formulaParser) parseUnary() (formulaNode, errors.Error) {
+	switch p.peek() {
+	case '-':
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(v float64) float64 { return -operand(v) }, nil
+	case '+':
+		p.pos++
+		return p.parseUnary()
+	}
+	return p.parsePower()
+}
+
+func (p *formulaParser) parsePower() (formulaNode, errors.Error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return func(v float64) float64 { return math.Pow(base(v), exponent(v)) }, nil
+}
+
+func (p *formulaParser) parsePrimary() (formulaNode, errors.Error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, p.error("Unexpected end of expression.")
+	case c == '$':
+		p.pos++
+		return func(v float64) float64 { return v }, nil
+	case c == '(':
+		p.pos++
+		node, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.error("Missing ')'.")
+		}
+		p.pos++
+		return node, nil
+	case unicode.IsDigit(c) || c == '.':
+		return p.parseNumber()
+	case unicode.IsLetter(c):
+		return p.parseIdentifier()
+	}
+	return nil, p.error("Unexpected '%c'.", c)
+}
+
+func (p *formulaParser) parseNumber() (formulaNode, errors.Error) {
+	start := p.pos
+	for p.pos < len(p.expression) && (unicode.IsDigit(p.expression[p.pos]) || p.expression[p.pos] == '.') {
+		p.pos++
+	}
+	// Exponent, only when followed by digits so "2e" is not mistaken for one.
+	if p.pos < len(p.expression) && (p.expression[p.pos] == 'e' || p.expression[p.pos] == 'E') {
+		end := p.pos + 1
+		if end < len(p.expression) && (p.expression[end] == '+' || p.expression[end] == '-') {
+			end++
+		}
+		if end < len(p.expression) && unicode.IsDigit(p.expression[end]) {
+			p.pos = end
+			for p.pos < len(p.expression) && unicode.IsDigit(p.expression[p.pos]) {
+				p.pos++
+			}
+		}
+	}
+	text := string(p.expression[start:p.pos])
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.error("Invalid number %s.", text)
+	}
+	return func(v float64) float64 { return number }, nil
+}
+
+func (p *formulaParser) parseIdentifier() (formulaNode, errors.Error) {
+	start := p.pos
+	for p.pos < len(p.expression) && (unicode.IsLetter(p.expression[p.pos]) || unicode.IsDigit(p.expression[p.pos])) {
+		p.pos++
+	}
+	name := strings.ToLower(string(p.expression[start:p.pos]))
+	if p.peek() != '(' {
+		constant, ok := formulaConstants[name]
+		if !ok {
+			return nil, p.error("Unknown constant %s.", name)
+		}
+		return func(v float64) float64 { return constant }, nil
+	}
+	function, ok := formulaFunctions[name]
+	if !ok {
+		return nil, p.error("Unknown function %s.", name)
+	}
+	p.pos++
+	arguments := []formulaNode{}
+	for p.peek() != ')' {
+		if len(arguments) > 0 {
+			if p.peek() != ',' {
+				return nil, p.error("Missing ',' or ')'.")
+			}
+			p.pos++
+		}
+		argument, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	p.pos++
+	if len(arguments) != function.arity {
+		return nil, p.error("%s expects %d arguments, got %d.", name, function.arity, len(arguments))
+	}
+	return func(v float64) float64 {
+		args := make([]float64, len(arguments))
+		for i, argument := range arguments {
+			args[i] = argument(v)
+		}
+		return function.call(args)
+	}, nil
+}
+
+// GetDisplayValue returns the value shown to operators. The formula, if any, is
+// applied to the numeric value. Otherwise integer values are divided by the
+// factor.
+func (contents *ParameterContents) GetDisplayValue() (float64, errors.Error) {
+	value, ok := numericValue(contents.GetValueObject())
+	if !ok {
+		return 0, errors.New("Parameter value is not a number.")
+	}
+	formula, err := contents.GetFormula()
+	if err != nil || strings.TrimSpace(formula) == "" {
+		if factor := contents.getIntegerFactor(); factor != 0 {
+			return value / float64(factor), nil
+		}
+		return value, nil
+	}
+	f, err := ParseFormula(formula)
+	if err != nil {
+		return 0, errors.Update(err)
+	}
+	return f.ToConsumer(value)
+}
+
+// DisplayToValue converts a value shown to operators back to a value of the
+// parameter type. Integer values are rounded.
+func (contents *ParameterContents) DisplayToValue(display float64) (*ContentParameter, errors.Error) {
+	value := display
+	formula, err := contents.GetFormula()
+	if err == nil && strings.TrimSpace(formula) != "" {
+		f, err := ParseFormula(formula)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		value, err = f.ToProvider(display)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	} else if factor := contents.getIntegerFactor(); factor != 0 {
+		value = display * float64(factor)
+	}
+	valueType := contents.GetValueType()
+	if valueType == ValueTypeInteger {
+		value = math.Round(value)
+	}
+	return NewValue(value, valueType)
+}
+
+// getIntegerFactor returns the factor of an integer parameter or 0 when there
+// is nothing to apply.
+func (contents *ParameterContents) getIntegerFactor() int64 {
+	if contents.GetValueType() != ValueTypeInteger {
+		return 0
+	}
+	factor, err := contents.GetFactor()
+	if err != nil || factor == 0 || factor == 1 {
+		return 0
+	}
+	return factor
+}
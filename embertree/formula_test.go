@@ -0,0 +1,80 @@
+package embertree_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func TestParseFormula(t *testing.T) {
+	tests := []struct {
+		formula  string
+		value    float64
+		expected float64
+	}{
+		{"$/10", 125, 12.5},
+		{"2+3*$", 2, 8},
+		{"(2+3)*$", 2, 10},
+		{"-$^2", 3, -9},
+		{"2^3^2", 0, 512},
+		{"$%7", 10, 3},
+		{"20*log($)", 100, 40},
+		{"max(min($, 10), -10)", 42, 10},
+		{"round(ln(e^$))", 2, 2},
+		{"1.5e2 + pi - PI", 0, 150},
+	}
+	for _, test := range tests {
+		formula, err := embertree.ParseFormula(test.formula)
+		if err != nil {
+			t.Errorf("Failed to parse %s. %s", test.formula, err.Message)
+			continue
+		}
+		result, err := formula.ToConsumer(test.value)
+		if err != nil {
+			t.Errorf("Failed to evaluate %s. %s", test.formula, err.Message)
+			continue
+		}
+		if math.Abs(result-test.expected) > 1e-9 {
+			t.Errorf("%s for %g: got %g instead of %g", test.formula, test.value, result, test.expected)
+		}
+	}
+}
+
+func TestParseFormulaErrors(t *testing.T) {
+	for _, formula := range []string{"$+", "($", "foo($)", "pow($)", "x", "$ $", "2..5"} {
+		if _, err := embertree.ParseFormula(formula); err == nil {
+			t.Errorf("Expected an error parsing %s", formula)
+		}
+	}
+	formula, _ := embertree.ParseFormula("log($)")
+	if _, err := formula.ToConsumer(-1); err == nil {
+		t.Error("Expected an error for a result not a number")
+	}
+	if _, err := formula.ToProvider(1); err == nil {
+		t.Error("Expected an error without consumer to provider expression")
+	}
+}
+
+func TestParameterDisplayValue(t *testing.T) {
+	contents := embertree.NewParameterContents().(*embertree.ParameterContents)
+	contents.SetType(embertree.ParameterTypeInteger)
+	contents.GetValueObject().SetInt(-200)
+	display, err := contents.GetDisplayValue()
+	if err != nil || display != -200 {
+		t.Errorf("Unexpected display value %g without formula", display)
+	}
+
+	contents.SetFormula("$/32\n$*32")
+	display, err = contents.GetDisplayValue()
+	if err != nil || display != -6.25 {
+		t.Errorf("Unexpected display value %g", display)
+	}
+	value, err := contents.DisplayToValue(-6.26)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != -200 {
+		t.Errorf("Unexpected value %d", i)
+	}
+}
@@ -8,28 +8,6 @@ import (
 	"github.com/dufourgilles/emberlib/asn1"
 )
 
-type ParameterType uint8
-
-const (
-	ParameterTypeNull    ParameterType = 0
-	ParameterTypeInteger ParameterType = iota
-	ParameterTypeReal    ParameterType = iota
-	ParameterTypeString  ParameterType = iota
-	ParameterTypeBoolean ParameterType = iota
-	ParameterTypeTrigger ParameterType = iota
-	ParameterTypeEnum    ParameterType = iota
-	ParameterTypeOcets   ParameterType = iota
-)
-
-type ParamaterAccess uint8
-
-const (
-	ParamaterAccessNone      ParamaterAccess = 0
-	ParamaterAccessRead      ParamaterAccess = iota
-	ParamaterAccessWrite     ParamaterAccess = iota
-	ParamaterAccessReadWrite ParamaterAccess = iota
-)
-
 type TupleDescription struct {
 	Type ParameterType
 	Name      string
@@ -46,6 +24,28 @@ type FunctionContents struct {
 var FunctionApplication = asn1.Application(19)
 var TupleDescriptionApplication = asn1.Application(21)
 
+func (contents *FunctionContents) merge(update EmberContents) ([]FieldChange, bool) {
+	u, ok := update.(*FunctionContents)
+	if !ok {
+		return nil, false
+	}
+	changes := contents.identifier.mergeField("identifier", &u.identifier, nil)
+	changes = contents.description.mergeField("description", &u.description, changes)
+	if u.arguments != nil {
+		changes = appendChange(changes, "arguments", contents.arguments, u.arguments)
+		contents.arguments = u.arguments
+	}
+	if u.result != nil {
+		changes = appendChange(changes, "result", contents.result, u.result)
+		contents.result = u.result
+	}
+	if len(u.templateReference) > 0 {
+		changes = appendChange(changes, "templateReference", contents.templateReference, u.templateReference)
+		contents.templateReference = u.templateReference
+	}
+	return changes, true
+}
+
 func NewArgument(t ParameterType, name string) *TupleDescription {
 	return &TupleDescription{Type: t, Name: name}
 }
@@ -74,6 +74,14 @@ func (contents *FunctionContents) GetDescription() (string, errors.Error) {
 	return contents.description.GetString()
 }
 
+func (contents *FunctionContents) SetTemplateReference(templateReference asn1.RelativeOID) {
+	contents.templateReference = templateReference
+}
+
+func (contents *FunctionContents) GetTemplateReference() (asn1.RelativeOID, errors.Error) {
+	return contents.templateReference, nil
+}
+
 func (contents *FunctionContents) SetArguments(arguments []*TupleDescription) {
 	contents.arguments = arguments
 }
@@ -90,6 +98,53 @@ func (contents *FunctionContents) GetResult() []*TupleDescription {
 	return contents.result
 }
 
+// convertTuple converts values to the types of the tuple descriptions.
+func convertTuple(values []interface{}, descriptions []*TupleDescription) ([]*ContentParameter, errors.Error) {
+	if len(descriptions) > 0 && len(values) != len(descriptions) {
+		return nil, errors.New("Invalid tuple size %d. Expected %d.", len(values), len(descriptions))
+	}
+	tuple := []*ContentParameter{}
+	for i, value := range values {
+		valueType := ValueTypeUnset
+		if i < len(descriptions) {
+			valueType = ParameterType2ValueType(descriptions[i].Type)
+		}
+		cp, err := NewValue(value, valueType)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		tuple = append(tuple, cp)
+	}
+	return tuple, nil
+}
+
+// NewArguments converts values to the argument types of the function.
+func (contents *FunctionContents) NewArguments(values []interface{}) ([]*ContentParameter, errors.Error) {
+	return convertTuple(values, contents.arguments)
+}
+
+// ConvertResult converts the values of an invocation result to the result types
+// of the function.
+func (contents *FunctionContents) ConvertResult(result []*ContentParameter) ([]*ContentParameter, errors.Error) {
+	values := make([]interface{}, len(result))
+	for i, value := range result {
+		values[i] = value
+	}
+	return convertTuple(values, contents.result)
+}
+
+// GetInvokeMsg builds the message invoking the function with invocation.
+func (element *Element) GetInvokeMsg(invocation *Invocation) (*RootElement, errors.Error) {
+	if GetUnqualifiedTag(element.tag) != FunctionApplication {
+		return nil, errors.New("Element %s is not a function.", Path2String(element.GetPath()))
+	}
+	dupElement := NewQualifiedFunction(element.GetPath())
+	dupElement.AddChild(NewInvokeCommand(invocation))
+	root := NewRoot()
+	root.AddElement(dupElement)
+	return root, nil
+}
+
 func decodeTupleDescriptions(reader *asn1.ASNReader) ([]*TupleDescription, errors.Error) {
 	arguments := []*TupleDescription{}
 	_, seqReader, err := reader.ReadSequenceStart(asn1.EMBER_SEQUENCE)
@@ -285,6 +340,17 @@ func (fc *FunctionContents) Decode(reader *asn1.ASNReader) errors.Error {
 				return errors.Update(err)
 			}
 			break
+		case asn1.Context(4):
+			templateReference, err := ctxtReader.ReadOID(asn1.EMBER_RELATIVE_OID)
+			if err != nil {
+				return errors.Update(err)
+			}
+			fc.templateReference = templateReference
+			err = ctxtReader.ReadSequenceEnd()
+			if err != nil {
+				return errors.Update(err)
+			}
+			break
 		default:
 			return errors.New("Unknown function content tag %d", peek)
 		}
@@ -328,6 +394,21 @@ func (fc *FunctionContents) Encode(writer *asn1.ASNWriter) errors.Error {
 			return errors.Update(err)
 		}
 	}
+
+	if fc.templateReference != nil {
+		err = writer.StartSequence(asn1.Context(4))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.WriteRelativeOID(fc.templateReference)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
 	writer.EndSequence()
 	return nil
 }
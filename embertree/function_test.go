@@ -7,6 +7,7 @@ import (
 
 	"github.com/dufourgilles/emberlib/asn1"
 	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
 )
 
 func TestFunctionDecode(t *testing.T) {
@@ -63,4 +64,103 @@ func TestFunctionEncode(t *testing.T) {
 
 	fmt.Println(decodedFunction)
 	//t.Errorf("err")
-}
\ No newline at end of file
+}
+func TestInvokeCommandEncode(t *testing.T) {
+	f := embertree.NewFunction(3)
+	fc := f.CreateContent().(*embertree.FunctionContents)
+	fc.SetArguments([]*embertree.TupleDescription{
+		embertree.NewArgument(embertree.ParameterTypeInteger, "a"),
+		embertree.NewArgument(embertree.ParameterTypeReal, "b")})
+	arguments, err := fc.NewArguments([]interface{}{1, 2})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	msg, err := f.GetInvokeMsg(embertree.NewInvocation(5, arguments))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	writer := asn1.NewASNWriter()
+	err = msg.Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	elements, err := embertree.DecodeRootElementCollection(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if len(elements) != 1 || elements[0].GetTag() != embertree.QualifiedFunctionApplication {
+		t.Fatal("Expected a qualified function")
+	}
+	command := elements[0].Children[embertree.COMMAND_INVOKE]
+	if command == nil {
+		t.Fatal("Invoke command not decoded")
+	}
+	invocation := command.GetContent().(*embertree.CommandContents).GetInvocation()
+	if invocation == nil || invocation.GetID() != 5 || len(invocation.GetArguments()) != 2 {
+		t.Fatal("Invalid invocation decoded")
+	}
+	r, err := invocation.GetArguments()[1].GetReal()
+	if err != nil || r != 2 {
+		t.Errorf("Invalid real argument")
+	}
+	_, err = fc.NewArguments([]interface{}{1})
+	if err == nil {
+		t.Errorf("Expected error with missing argument")
+	}
+}
+
+type invocationListener struct {
+	result *embertree.InvocationResult
+}
+
+func (l *invocationListener) Receive(node interface{}, err errors.Error) {
+	l.result, _ = node.(*embertree.InvocationResult)
+}
+
+func TestInvocationResultDecode(t *testing.T) {
+	value := embertree.NewContentParameter()
+	value.SetString("done")
+	writer := asn1.NewASNWriter()
+	err := embertree.NewInvocationResultRoot(embertree.NewInvocationResult(9, true, []*embertree.ContentParameter{value})).Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	tree := embertree.NewTree()
+	listener := &invocationListener{}
+	tree.AddInvocationListener(9, listener)
+	err = tree.Decode(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if listener.result == nil || !listener.result.GetSuccess() || len(listener.result.GetResult()) != 1 {
+		t.Fatal("InvocationResult not received")
+	}
+	s, _ := listener.result.GetResult()[0].GetString()
+	if s != "done" {
+		t.Errorf("Invalid result %s", s)
+	}
+}
+
+func TestFunctionSparseUpdate(t *testing.T) {
+	function := embertree.NewFunction(1)
+	contents := function.CreateContent().(*embertree.FunctionContents)
+	contents.SetIdentifier("add")
+	contents.SetArguments([]*embertree.TupleDescription{embertree.NewArgument(embertree.ParameterTypeInteger, "a")})
+
+	update := embertree.NewFunction(1)
+	update.CreateContent().(*embertree.FunctionContents).SetDescription("Adds integers")
+	err := function.Update(roundTrip(t, update))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	contents = function.GetContent().(*embertree.FunctionContents)
+	identifier, _ := contents.GetIdentifier()
+	description, _ := contents.GetDescription()
+	if identifier != "add" || description != "Adds integers" || len(contents.GetArguments()) != 1 {
+		t.Errorf("Invalid merge: identifier %s description %s arguments %d", identifier, description, len(contents.GetArguments()))
+	}
+}
@@ -0,0 +1,141 @@
+package embertree
+
+// treeIndex maps the numeric paths, the identifier paths and the stream
+// identifiers to the elements of a tree. It is updated with the elements
+// received so lookups don't walk the tree.
+type treeIndex struct {
+	byPath           map[string]*Element
+	byIdentifierPath map[string]*Element
+	byStream         map[int][]*Element
+	// identifierPaths and streams hold the keys of each element to update the
+	// index when they change.
+	identifierPaths map[*Element]string
+	streams         map[*Element]int
+}
+
+func newTreeIndex() *treeIndex {
+	return &treeIndex{
+		byPath:           make(map[string]*Element),
+		byIdentifierPath: make(map[string]*Element),
+		byStream:         make(map[int][]*Element),
+		identifierPaths:  make(map[*Element]string),
+		streams:          make(map[*Element]int),
+	}
+}
+
+// add indexes element. Its subtree is indexed too when subtree is set or when
+// the identifier path of element changed.
+func (index *treeIndex) add(element *Element, subtree bool) {
+	if index.indexElement(element) || subtree {
+		for _, child := range element.Children {
+			index.add(child, true)
+		}
+	}
+}
+
+// indexElement updates the entries of element and returns true if its
+// identifier path changed.
+func (index *treeIndex) indexElement(element *Element) bool {
+	index.byPath[Path2String(element.GetPath())] = element
+
+	identifierPath := ""
+	if identifier, err := element.GetIdentifier(); err == nil && identifier != "" {
+		if element.parent == nil {
+			identifierPath = identifier
+		} else if parentPath, ok := index.identifierPaths[element.parent]; ok {
+			identifierPath = parentPath + "/" + identifier
+		}
+	}
+	previousPath, indexed := index.identifierPaths[element]
+	renamed := previousPath != identifierPath
+	if renamed {
+		if indexed && index.byIdentifierPath[previousPath] == element {
+			delete(index.byIdentifierPath, previousPath)
+		}
+		if identifierPath == "" {
+			delete(index.identifierPaths, element)
+		} else {
+			index.identifierPaths[element] = identifierPath
+		}
+	}
+	if identifierPath != "" {
+		index.byIdentifierPath[identifierPath] = element
+	}
+
+	stream := -1
+	if contents, ok := element.contents.(*ParameterContents); ok {
+		if id, err := contents.GetStreamIdentifier(); err == nil {
+			stream = int(id)
+		}
+	}
+	previousStream, indexed := index.streams[element]
+	if !indexed {
+		previousStream = -1
+	}
+	if stream != previousStream {
+		if indexed {
+			index.removeStream(element, previousStream)
+		}
+		if stream >= 0 {
+			index.streams[element] = stream
+			index.byStream[stream] = append(index.byStream[stream], element)
+		}
+	}
+	return renamed
+}
+
+func (index *treeIndex) removeStream(element *Element, stream int) {
+	delete(index.streams, element)
+	parameters := index.byStream[stream]
+	for i, parameter := range parameters {
+		if parameter == element {
+			parameters = append(parameters[:i], parameters[i+1:]...)
+			break
+		}
+	}
+	if len(parameters) == 0 {
+		delete(index.byStream, stream)
+	} else {
+		index.byStream[stream] = parameters
+	}
+}
+
+// isAttached checks that neither an indexed element nor one of its ancestors has
+// been replaced in the tree.
+func (root *RootElement) isAttached(element *Element) bool {
+	for element.parent != nil {
+		if element.parent.Children[element.Number] != element {
+			return false
+		}
+		element = element.parent
+	}
+	return root.RootElementCollection[element.Number] == element
+}
+
+// Reindex rebuilds the indexes of the tree. The elements added and the updates
+// decoded are indexed as they come. Reindex is only needed after changing the
+// identifier or the stream identifier of contents already in the tree.
+func (root *RootElement) Reindex() {
+	root.index = newTreeIndex()
+	for _, element := range root.RootElementCollection {
+		root.index.add(element, true)
+	}
+}
+
+// GetStreamParameters returns the parameters using streamIdentifier.
+func (root *RootElement) GetStreamParameters(streamIdentifier int) []*Element {
+	if root.index == nil {
+		parameters := []*Element{}
+		for _, element := range root.RootElementCollection {
+			parameters = root.getStreamParameters(element, streamIdentifier, parameters)
+		}
+		return parameters
+	}
+	parameters := []*Element{}
+	for _, parameter := range root.index.byStream[streamIdentifier] {
+		if root.isAttached(parameter) {
+			parameters = append(parameters, parameter)
+		}
+	}
+	return parameters
+}
@@ -0,0 +1,81 @@
+package embertree_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func TestTreeIndex(t *testing.T) {
+	tree := embertree.NewTree()
+	message := embertree.NewRoot()
+	node := embertree.NewNode(1)
+	node.CreateContent().(*embertree.NodeContents).SetIdentifier("mixer")
+	meter := embertree.NewParameter(2)
+	meterContents := meter.CreateContent().(*embertree.ParameterContents)
+	meterContents.SetIdentifier("meter")
+	meterContents.SetStreanIdentifier(10)
+	node.AddChild(meter)
+	message.AddElement(node)
+	decodeRoot(t, tree, message)
+
+	meter = tree.GetElementByIdentifierPath("mixer/meter")
+	if meter == nil {
+		t.Fatal("mixer/meter not indexed")
+	}
+	if _, element := tree.GetElementByPath(asn1.RelativeOID{1, 2}); element != meter {
+		t.Errorf("1.2 not indexed")
+	}
+	if parameters := tree.GetStreamParameters(10); len(parameters) != 1 || parameters[0] != meter {
+		t.Errorf("Stream 10 not indexed")
+	}
+
+	// Qualified updates renaming the node and moving the meter to another stream.
+	message = embertree.NewRoot()
+	renamed := embertree.NewQualifiedNode(asn1.RelativeOID{1})
+	renamed.CreateContent().(*embertree.NodeContents).SetIdentifier("console")
+	message.AddElement(renamed)
+	decodeRoot(t, tree, message)
+	message = embertree.NewRoot()
+	moved := embertree.NewQualifiedParameter(asn1.RelativeOID{1, 2})
+	moved.CreateContent().(*embertree.ParameterContents).SetStreanIdentifier(11)
+	message.AddElement(moved)
+	decodeRoot(t, tree, message)
+
+	if tree.GetElementByIdentifierPath("console/meter") != meter {
+		t.Errorf("console/meter not indexed")
+	}
+	if tree.GetElementByIdentifierPath("mixer/meter") != nil || tree.GetElementByIdentifier("mixer") != nil {
+		t.Errorf("mixer still indexed")
+	}
+	if len(tree.GetStreamParameters(10)) != 0 {
+		t.Errorf("Stream 10 still indexed")
+	}
+	if parameters := tree.GetStreamParameters(11); len(parameters) != 1 || parameters[0] != meter {
+		t.Errorf("Stream 11 not indexed")
+	}
+
+	// Children added to an element of the tree are indexed.
+	gain := embertree.NewParameter(3)
+	gain.CreateContent().(*embertree.ParameterContents).SetIdentifier("gain")
+	tree.GetElementByIdentifier("console").AddChild(gain)
+	if tree.GetElementByIdentifierPath("console/gain") != gain {
+		t.Errorf("console/gain not indexed")
+	}
+
+	// Replacing an ancestor detaches the indexed descendants.
+	fader := embertree.NewParameter(1)
+	fader.CreateContent().(*embertree.ParameterContents).SetIdentifier("fader")
+	gain.AddChild(fader)
+	if tree.GetElementByIdentifierPath("console/gain/fader") != fader {
+		t.Fatal("console/gain/fader not indexed")
+	}
+	tree.AddElement(embertree.NewNode(1))
+	if tree.GetElementByIdentifierPath("console/gain/fader") != nil {
+		t.Errorf("console/gain/fader still found after replacing console")
+	}
+	if _, element := tree.GetElementByPath(asn1.RelativeOID{1, 3, 1}); element != nil {
+		t.Errorf("1.3.1 still found after replacing console")
+	}
+}
@@ -7,6 +7,7 @@ import (
 )
 
 var InvocationApplication = asn1.Application(22)
+var InvocationResultApplication = asn1.Application(23)
 
 type Invocation struct {
 	invocationID int
@@ -17,6 +18,14 @@ func NewInvocation(id int, arguments []*ContentParameter) *Invocation {
 	return &Invocation{invocationID: id, arguments: arguments}
 }
 
+func (i *Invocation) GetID() int {
+	return i.invocationID
+}
+
+func (i *Invocation) GetArguments() []*ContentParameter {
+	return i.arguments
+}
+
 func (i *Invocation) Encode(writer *asn1.ASNWriter) errors.Error {
 	err := writer.StartSequence(InvocationApplication)
 	if err != nil {
@@ -106,6 +115,7 @@ func (i *Invocation) Decode(reader *asn1.ASNReader) errors.Error {
 					return errors.Update(err)
 				}
 			}
+			i.arguments = arguments
 			break
 		default:
 			return errors.New("Invovation decode error: Unknwon tag %d", peek)
@@ -121,3 +131,156 @@ func (i *Invocation) Decode(reader *asn1.ASNReader) errors.Error {
 	}
 	return errors.Update(err)
 }
+
+type InvocationResult struct {
+	invocationID int
+	success      bool
+	result       []*ContentParameter
+}
+
+func NewInvocationResult(id int, success bool, result []*ContentParameter) *InvocationResult {
+	return &InvocationResult{invocationID: id, success: success, result: result}
+}
+
+func (r *InvocationResult) GetID() int {
+	return r.invocationID
+}
+
+func (r *InvocationResult) GetSuccess() bool {
+	return r.success
+}
+
+func (r *InvocationResult) GetResult() []*ContentParameter {
+	return r.result
+}
+
+func (r *InvocationResult) SetResult(result []*ContentParameter) {
+	r.result = result
+}
+
+func (r *InvocationResult) Encode(writer *asn1.ASNWriter) errors.Error {
+	err := writer.StartSequence(InvocationResultApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+
+	err = writer.StartSequence(asn1.Context(0))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.WriteInt(r.invocationID)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.EndSequence()
+	if err != nil {
+		return errors.Update(err)
+	}
+
+	err = writer.StartSequence(asn1.Context(1))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.WriteBoolean(r.success)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.EndSequence()
+	if err != nil {
+		return errors.Update(err)
+	}
+
+	if len(r.result) > 0 {
+		err = writer.StartSequence(asn1.Context(2))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.StartSequence(asn1.EMBER_SEQUENCE)
+		if err != nil {
+			return errors.Update(err)
+		}
+		for _, value := range r.result {
+			err = value.Encode(0, writer)
+			if err != nil {
+				return errors.Update(err)
+			}
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return writer.EndSequence()
+}
+
+func (r *InvocationResult) Decode(reader *asn1.ASNReader) errors.Error {
+	_, resultReader, err := reader.ReadSequenceStart(InvocationResultApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	// success is optional and defaults to true.
+	r.success = true
+	for resultReader.Len() > 0 {
+		peek, err := resultReader.Peek()
+		if err != nil {
+			return errors.Update(err)
+		}
+		_, ctxtReader, err := resultReader.ReadSequenceStart(peek)
+		if err != nil {
+			return errors.Update(err)
+		}
+		switch peek {
+		case asn1.Context(0):
+			id, err := ctxtReader.ReadInt()
+			if err != nil {
+				return errors.Update(err)
+			}
+			r.invocationID = id
+			break
+		case asn1.Context(1):
+			success, err := ctxtReader.ReadBoolean()
+			if err != nil {
+				return errors.Update(err)
+			}
+			r.success = success
+			break
+		case asn1.Context(2):
+			result := []*ContentParameter{}
+			_, seqReader, err := ctxtReader.ReadSequenceStart(asn1.EMBER_SEQUENCE)
+			if err != nil {
+				return errors.Update(err)
+			}
+			for seqReader.Len() > 0 {
+				value, err := DecodeValue(seqReader, 0)
+				if err != nil {
+					return errors.Update(err)
+				}
+				result = append(result, value)
+				end, err := seqReader.CheckSequenceEnd()
+				if end {
+					break
+				}
+				if err != nil {
+					return errors.Update(err)
+				}
+			}
+			r.result = result
+			break
+		default:
+			return errors.New("InvocationResult decode error: Unknown tag %d", peek)
+		}
+		err = ctxtReader.ReadSequenceEnd()
+		if err != nil {
+			return errors.Update(err)
+		}
+		end, err := resultReader.CheckSequenceEnd()
+		if end || err != nil {
+			break
+		}
+	}
+	return errors.Update(err)
+}
@@ -7,16 +7,17 @@ import (
 	"github.com/dufourgilles/emberlib/errors"
 )
 
+// Matrix contents context numbers. 0 and 1 are the identifier and description.
 const (
-	matrixTypeCtx               = 2
-	matrixModeCtx               = iota
-	targetCountCtx              = iota
-	sourceCounCtx               = iota
-	maximumTotalConnectsCtx     = iota
-	maximumConnectsPerTargetCtx = iota
-	parametersLocationCtx       = iota
-	gainParameterNumberCtx      = iota
-	matrixContentSize           = iota
+	matrixTypeCtx               = iota + 2
+	matrixModeCtx               = iota + 2
+	targetCountCtx              = iota + 2
+	sourceCounCtx               = iota + 2
+	maximumTotalConnectsCtx     = iota + 2
+	maximumConnectsPerTargetCtx = iota + 2
+	parametersLocationCtx       = iota + 2
+	gainParameterNumberCtx      = iota + 2
+	matrixContentSize           = iota + 2
 )
 
 type MatrixType int8
@@ -47,6 +48,32 @@ type MatrixContent struct {
 	table             [matrixContentSize]ContentParameter
 }
 
+var matrixFieldNames = [matrixContentSize]string{
+	"identifier", "description", "type", "addressingMode", "targetCount", "sourceCount",
+	"maximumTotalConnects", "maximumConnectsPerTarget", "parametersLocation", "gainParameterNumber",
+}
+
+func (c *MatrixContent) merge(update EmberContents) ([]FieldChange, bool) {
+	u, ok := update.(*MatrixContent)
+	if !ok {
+		return nil, false
+	}
+	changes := []FieldChange{}
+	for i := range c.table {
+		changes = c.table[i].mergeField(matrixFieldNames[i], &u.table[i], changes)
+	}
+	if len(u.labels) > 0 {
+		changes = appendChange(changes, "labels", c.labels, u.labels)
+		c.labels = u.labels
+	}
+	changes = c.schemaIdentifier.mergeField("schemaIdentifiers", &u.schemaIdentifier, changes)
+	if len(u.templateReference) > 0 {
+		changes = appendChange(changes, "templateReference", c.templateReference, u.templateReference)
+		c.templateReference = u.templateReference
+	}
+	return changes, true
+}
+
 func ValidateMatrixType(mtype MatrixType) errors.Error {
 	if mtype < OneToN || mtype > NToN {
 		return errors.New("Invalid matrix type %d", mtype)
@@ -86,6 +113,14 @@ func (contents *MatrixContent) GetDescription() (string, errors.Error) {
 	return contents.table[descriptionCtx].GetString()
 }
 
+func (contents *MatrixContent) SetTemplateReference(templateReference asn1.RelativeOID) {
+	contents.templateReference = templateReference
+}
+
+func (contents *MatrixContent) GetTemplateReference() (asn1.RelativeOID, errors.Error) {
+	return contents.templateReference, nil
+}
+
 func (c *MatrixContent) GetType() (MatrixType, errors.Error) {
 	v, err := c.table[matrixTypeCtx].GetInt()
 	if err != nil {
@@ -271,7 +306,15 @@ func (c *MatrixContent) DecodeLabels(reader *asn1.ASNReader) errors.Error {
 	if err != nil {
 		return errors.Update(err)
 	}
-	for seqReader.Len() > 0 {
+	for {
+		// The label sequence may be empty.
+		end, err := seqReader.CheckSequenceEnd()
+		if err != nil {
+			return errors.Update(err)
+		}
+		if end {
+			break
+		}
 		_, ctxtReader, err := seqReader.ReadSequenceStart(asn1.Context(0))
 		if err != nil {
 			return errors.Update(err)
@@ -285,15 +328,8 @@ func (c *MatrixContent) DecodeLabels(reader *asn1.ASNReader) errors.Error {
 		if err != nil {
 			return errors.Update(err)
 		}
-		end, err := seqReader.CheckSequenceEnd()
-		if end {
-			break
-		}
-		if err != nil {
-			return errors.Update(err)
-		}
 	}
-	err = reader.ReadSequenceEnd()
+	err = labelReader.ReadSequenceEnd()
 	if err != nil {
 		return errors.Update(err)
 	}
@@ -364,7 +400,10 @@ func (c *MatrixContent) Decode(reader *asn1.ASNReader) errors.Error {
 				return errors.Update(err)
 			}
 		} else if peek == labelContext {
-			c.DecodeLabels(matrixContentReader)
+			err = c.DecodeLabels(matrixContentReader)
+			if err != nil {
+				return errors.Update(err)
+			}
 		} else if index == 11 {
 			value, err := DecodeValue(matrixContentReader, index)
 			if err != nil {
@@ -411,17 +450,17 @@ func (c *MatrixContent) ToString() string {
 	}
 	t,err := c.GetType()
 	if t == OneToN {
-		str = fmt.Sprintf(("%s  type: OneToN"))
+		str = fmt.Sprintf("%s  type: OneToN\n", str)
 	} else if t ==  NToN {
-		str = fmt.Sprintf(("%s  type: NToN"))
+		str = fmt.Sprintf("%s  type: NToN\n", str)
 	} else {
-		str = fmt.Sprintf(("%s  type: OneToOne"))
+		str = fmt.Sprintf("%s  type: OneToOne\n", str)
 	}
 	m,err := c.GetMode()
 	if m == Linear {
-		str = fmt.Sprintf(("%s  mode: Linear"))
+		str = fmt.Sprintf("%s  mode: Linear\n", str)
 	} else {
-		str = fmt.Sprintf(("%s  mode: Non-Linear"))
+		str = fmt.Sprintf("%s  mode: Non-Linear\n", str)
 	}
 	return fmt.Sprintf("{\n%s}\n", str)
 }
\ No newline at end of file
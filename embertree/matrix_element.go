@@ -224,3 +224,44 @@ func (element *Element) GetConnections() ([]*Connection, errors.Error) {
 	}
 	return element.connections, nil
 }
+
+// GetConnection returns the connection of target or nil.
+func (element *Element) GetConnection(target int32) *Connection {
+	for _, connection := range element.connections {
+		if connection.Target == target {
+			return connection
+		}
+	}
+	return nil
+}
+
+// mergeConnections replaces the connections of the targets present in connections
+// and keeps the others.
+func (element *Element) mergeConnections(connections []*Connection) {
+	for _, connection := range connections {
+		replaced := false
+		for i, current := range element.connections {
+			if current.Target == connection.Target {
+				element.connections[i] = connection
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			element.connections = append(element.connections, connection)
+		}
+	}
+}
+
+// GetConnectionMsg builds the message asking the provider to apply connection
+// on the matrix.
+func (element *Element) GetConnectionMsg(connection *Connection) (*RootElement, errors.Error) {
+	if !element.isMatrix {
+		return nil, errors.New("Element %s not a matrix.", Path2String(element.GetPath()))
+	}
+	dupElement := NewQualifiedMatrix(element.GetPath(), OneToN, Linear)
+	dupElement.connections = []*Connection{connection}
+	root := NewRoot()
+	root.AddElement(dupElement)
+	return root, nil
+}
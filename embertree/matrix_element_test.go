@@ -34,3 +34,33 @@ func TestDecodeTarget(t *testing.T) {
 		}
 	}
 }
+
+func TestMatrixSparseUpdate(t *testing.T) {
+	matrix, err := NewMatrix(1, NToN, Linear)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	contents := matrix.GetContent().(*MatrixContent)
+	contents.SetIdentifier("router")
+	contents.SetTargetCount(4)
+	matrix.SetConnections([]*Connection{NewConnection(0, []int32{1}, Absolute), NewConnection(1, []int32{2}, Absolute)})
+
+	update, err := NewMatrix(1, NToN, Linear)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	update.SetConnections([]*Connection{NewConnection(1, []int32{3}, Absolute)})
+	err = matrix.Update(roundTrip(t, update))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	identifier, _ := matrix.GetContent().(*MatrixContent).GetIdentifier()
+	count, _ := matrix.GetContent().(*MatrixContent).GetTargetCount()
+	if identifier != "router" || count != 4 {
+		t.Errorf("Invalid merge: identifier %s target count %d", identifier, count)
+	}
+	connections, _ := matrix.GetConnections()
+	if len(connections) != 2 || Path2String(matrix.GetConnection(0).Sources) != "1" || Path2String(matrix.GetConnection(1).Sources) != "3" {
+		t.Errorf("Connections not merged per target")
+	}
+}
@@ -23,6 +23,23 @@ func NewNodeContents() EmberContents {
 	return &NodeContents{}
 }
 
+func (contents *NodeContents) merge(update EmberContents) ([]FieldChange, bool) {
+	u, ok := update.(*NodeContents)
+	if !ok {
+		return nil, false
+	}
+	changes := contents.identifier.mergeField("identifier", &u.identifier, nil)
+	changes = contents.description.mergeField("description", &u.description, changes)
+	changes = contents.isRoot.mergeField("isRoot", &u.isRoot, changes)
+	changes = contents.isOnline.mergeField("isOnline", &u.isOnline, changes)
+	changes = contents.schemaIdentifiers.mergeField("schemaIdentifiers", &u.schemaIdentifiers, changes)
+	if len(u.templateReference) > 0 {
+		changes = appendChange(changes, "templateReference", contents.templateReference, u.templateReference)
+		contents.templateReference = u.templateReference
+	}
+	return changes, true
+}
+
 func NewNode(number int) *Element {
 	return NewElement(NodeApplication, number, NewNodeContents)
 }
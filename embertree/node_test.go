@@ -74,3 +74,25 @@ func TestNodeListener(t *testing.T) {
 		return
 	}
 }
+
+func TestNodeSparseUpdate(t *testing.T) {
+	node := embertree.NewNode(1)
+	contents := node.CreateContent().(*embertree.NodeContents)
+	contents.SetIdentifier("gdnet")
+	contents.SetDescription("Main node")
+	contents.SetIsOnline(true)
+
+	update := embertree.NewNode(1)
+	update.CreateContent().(*embertree.NodeContents).SetIsOnline(false)
+	err := node.Update(roundTrip(t, update))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	contents = node.GetContent().(*embertree.NodeContents)
+	identifier, _ := contents.GetIdentifier()
+	description, _ := contents.GetDescription()
+	isOnline, _ := contents.GetIsOnline()
+	if identifier != "gdnet" || description != "Main node" || isOnline {
+		t.Errorf("Invalid merge: identifier %s description %s online %t", identifier, description, isOnline)
+	}
+}
@@ -2,6 +2,7 @@ package embertree
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/dufourgilles/emberlib/errors"
 
@@ -32,8 +33,68 @@ const (
 
 var ParameterApplication = asn1.Application(1)
 
+// ParameterType is the Glow type of a parameter or of a function argument.
+type ParameterType uint8
+
+const (
+	ParameterTypeNull    ParameterType = 0
+	ParameterTypeInteger ParameterType = iota
+	ParameterTypeReal    ParameterType = iota
+	ParameterTypeString  ParameterType = iota
+	ParameterTypeBoolean ParameterType = iota
+	ParameterTypeTrigger ParameterType = iota
+	ParameterTypeEnum    ParameterType = iota
+	ParameterTypeOcets   ParameterType = iota
+)
+
+var parameterTypeNames = []string{"null", "integer", "real", "string", "boolean", "trigger", "enum", "octets"}
+
+func (t ParameterType) String() string {
+	if int(t) < len(parameterTypeNames) {
+		return parameterTypeNames[t]
+	}
+	return fmt.Sprintf("unknown(%d)", t)
+}
+
+// ParameterAccess is the Glow access of a parameter.
+type ParameterAccess uint8
+
+const (
+	ParameterAccessNone      ParameterAccess = 0
+	ParameterAccessRead      ParameterAccess = iota
+	ParameterAccessWrite     ParameterAccess = iota
+	ParameterAccessReadWrite ParameterAccess = iota
+)
+
+// Deprecated: use ParameterAccess.
+type ParamaterAccess = ParameterAccess
+
+// Deprecated: use the ParameterAccess constants.
+const (
+	ParamaterAccessNone      = ParameterAccessNone
+	ParamaterAccessRead      = ParameterAccessRead
+	ParamaterAccessWrite     = ParameterAccessWrite
+	ParamaterAccessReadWrite = ParameterAccessReadWrite
+)
+
+var parameterAccessNames = []string{"none", "read", "write", "readWrite"}
+
+func (access ParameterAccess) String() string {
+	if int(access) < len(parameterAccessNames) {
+		return parameterAccessNames[access]
+	}
+	return fmt.Sprintf("unknown(%d)", access)
+}
+
+// IsWritable returns true if consumers can change the value.
+func (access ParameterAccess) IsWritable() bool {
+	return access == ParameterAccessWrite || access == ParameterAccessReadWrite
+}
+
 type ParameterContents struct {
 	templateReference asn1.RelativeOID
+	streamDescriptor  *StreamDescription
+	enumMap           []EnumEntry
 	table             [parameterContentSize]ContentParameter
 }
 
@@ -42,6 +103,47 @@ func NewParameterContents() EmberContents {
 	return cp
 }
 
+var parameterFieldNames = [parameterContentSize]string{
+	"identifier", "description", "value", "minimum", "maximum", "access", "format",
+	"enumeration", "factor", "isOnline", "formula", "step", "default", "type",
+	"streamIdentifier", "enumMap", "streamDescriptor", "schemaIdentifiers",
+}
+
+// receivedFields returns the names of the fields set in the contents.
+func (contents *ParameterContents) receivedFields() []string {
+	fields := []string{}
+	for i := range contents.table {
+		if contents.table[i].isSet {
+			fields = append(fields, parameterFieldNames[i])
+		}
+	}
+	return fields
+}
+
+func (contents *ParameterContents) merge(update EmberContents) ([]FieldChange, bool) {
+	u, ok := update.(*ParameterContents)
+	if !ok {
+		return nil, false
+	}
+	changes := []FieldChange{}
+	for i := range contents.table {
+		changes = contents.table[i].mergeField(parameterFieldNames[i], &u.table[i], changes)
+	}
+	if len(u.templateReference) > 0 {
+		changes = appendChange(changes, "templateReference", contents.templateReference, u.templateReference)
+		contents.templateReference = u.templateReference
+	}
+	if u.enumMap != nil {
+		changes = appendChange(changes, "enumMap", contents.enumMap, u.enumMap)
+		contents.enumMap = u.enumMap
+	}
+	if u.streamDescriptor != nil {
+		changes = appendChange(changes, "streamDescriptor", contents.streamDescriptor, u.streamDescriptor)
+		contents.streamDescriptor = u.streamDescriptor
+	}
+	return changes, true
+}
+
 func NewParameter(number int) *Element {
 	return NewElement(ParameterApplication, number, NewParameterContents)
 }
@@ -62,6 +164,14 @@ func (contents *ParameterContents) GetDescription() (string, errors.Error) {
 	return contents.table[descriptionCtx].GetString()
 }
 
+func (contents *ParameterContents) SetTemplateReference(templateReference asn1.RelativeOID) {
+	contents.templateReference = templateReference
+}
+
+func (contents *ParameterContents) GetTemplateReference() (asn1.RelativeOID, errors.Error) {
+	return contents.templateReference, nil
+}
+
 func (contents *ParameterContents) GetValueObject() *ContentParameter {
 	return &contents.table[valueCtx]
 }
@@ -78,12 +188,18 @@ func (contents *ParameterContents) GetDefaultObject() *ContentParameter {
 	return &contents.table[defaultCtx]
 }
 
-func (contents *ParameterContents) SetAccess(access string) {
-	contents.table[accessCtx].SetString(access)
+func (contents *ParameterContents) SetAccess(access ParameterAccess) {
+	contents.table[accessCtx].SetInt(int64(access))
 }
 
-func (contents *ParameterContents) GetAccess() (string, errors.Error) {
-	return contents.table[accessCtx].GetString()
+// GetAccess returns the access of the parameter. Providers usually omit it for
+// read only parameters.
+func (contents *ParameterContents) GetAccess() (ParameterAccess, errors.Error) {
+	access, err := contents.table[accessCtx].GetInt()
+	if err != nil {
+		return ParameterAccessRead, errors.Update(err)
+	}
+	return ParameterAccess(access), nil
 }
 
 func (contents *ParameterContents) SetFormat(format string) {
@@ -134,12 +250,29 @@ func (contents *ParameterContents) GetStep() (int64, errors.Error) {
 	return contents.table[stepCtx].GetInt()
 }
 
-func (contents *ParameterContents) SetType(ptype string) {
-	contents.table[typeCtx].SetString(ptype)
+func (contents *ParameterContents) SetType(ptype ParameterType) {
+	contents.table[typeCtx].SetInt(int64(ptype))
 }
 
-func (contents *ParameterContents) GetType() (string, errors.Error) {
-	return contents.table[typeCtx].GetString()
+func (contents *ParameterContents) GetType() (ParameterType, errors.Error) {
+	ptype, err := contents.table[typeCtx].GetInt()
+	if err != nil {
+		return ParameterTypeNull, errors.Update(err)
+	}
+	return ParameterType(ptype), nil
+}
+
+// GetValueType returns the value type expected by the parameter. It is derived
+// from the parameter type or, when missing, from the current value.
+func (contents *ParameterContents) GetValueType() ValueType {
+	ptype, err := contents.GetType()
+	if err == nil {
+		valueType := ParameterType2ValueType(ptype)
+		if valueType != ValueTypeUnset {
+			return valueType
+		}
+	}
+	return contents.table[valueCtx].GetType()
 }
 
 func (contents *ParameterContents) SetStreanIdentifier(streamIdentifier int64) {
@@ -150,6 +283,82 @@ func (contents *ParameterContents) GetStreamIdentifier() (int64, errors.Error) {
 	return contents.table[streamIdentifierCtx].GetInt()
 }
 
+// GetSetValueMsg builds the message asking the provider to change the value of the
+// parameter. value is converted to the value type of the parameter.
+func (element *Element) GetSetValueMsg(value interface{}) (*RootElement, errors.Error) {
+	contents, ok := element.GetContent().(*ParameterContents)
+	if !ok || GetUnqualifiedTag(element.tag) != ParameterApplication {
+		return nil, errors.New("Element %s is not a parameter.", Path2String(element.GetPath()))
+	}
+	cp, err := NewValue(value, contents.GetValueType())
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	dupElement := NewQualifiedParameter(element.GetPath())
+	dupContents := dupElement.CreateContent().(*ParameterContents)
+	dupContents.table[valueCtx] = *cp
+	root := NewRoot()
+	root.AddElement(dupElement)
+	return root, nil
+}
+
+// ValidateValue checks that value can be written to the parameter. The parameter
+// must be writable, which it is not when the access is unset, and value must
+// convert to its value type, be within minimum and maximum and on the step grid
+// starting at minimum.
+func (contents *ParameterContents) ValidateValue(value interface{}) errors.Error {
+	// The error only tells the access is unset. The Ember+ default is then returned.
+	access, _ := contents.GetAccess()
+	if !access.IsWritable() {
+		return errors.New("Parameter access is %s. Value not writable.", access)
+	}
+	cp, err := NewValue(value, contents.GetValueType())
+	if err != nil {
+		return errors.Update(err)
+	}
+	v, ok := numericValue(cp)
+	if !ok {
+		return nil
+	}
+	minimum, hasMinimum := numericValue(contents.GetMinimumObject())
+	if hasMinimum && v < minimum {
+		return errors.New("Value %s below minimum %s.", cp.ToString(), contents.GetMinimumObject().ToString())
+	}
+	if maximum, ok := numericValue(contents.GetMaximumObject()); ok && v > maximum {
+		return errors.New("Value %s above maximum %s.", cp.ToString(), contents.GetMaximumObject().ToString())
+	}
+	step, err := contents.GetStep()
+	if err == nil && step > 0 {
+		steps := (v - minimum) / float64(step)
+		if math.Abs(steps-math.Round(steps)) > 1e-9 {
+			return errors.New("Value %s not a multiple of step %d.", cp.ToString(), step)
+		}
+	}
+	return nil
+}
+
+// numericValue returns the value of an integer or real parameter as a float.
+func numericValue(cp *ContentParameter) (float64, bool) {
+	switch cp.GetType() {
+	case ValueTypeInteger:
+		i, _ := cp.GetInt()
+		return float64(i), true
+	case ValueTypeReal:
+		r, _ := cp.GetReal()
+		return r, true
+	}
+	return 0, false
+}
+
+func (contents *ParameterContents) SetStreamDescriptor(descriptor *StreamDescription) {
+	contents.streamDescriptor = descriptor
+}
+
+// GetStreamDescriptor returns how the value is extracted from an octet string stream or nil.
+func (contents *ParameterContents) GetStreamDescriptor() *StreamDescription {
+	return contents.streamDescriptor
+}
+
 func (contents *ParameterContents) Encode(writer *asn1.ASNWriter) errors.Error {
 	err := writer.StartSequence(asn1.EMBER_SET)
 	if err != nil {
@@ -162,6 +371,34 @@ func (contents *ParameterContents) Encode(writer *asn1.ASNWriter) errors.Error {
 			return errors.Update(err)
 		}
 	}
+	if contents.streamDescriptor != nil {
+		err = writer.StartSequence(asn1.Context(streamDescriptorCtx))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = contents.streamDescriptor.Encode(writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	if contents.enumMap != nil {
+		err = writer.StartSequence(asn1.Context(enumMapCtx))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = encodeEnumMap(contents.enumMap, writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
 	if contents.templateReference != nil {
 		err = writer.StartSequence(asn1.Context(18))
 		if err != nil {
@@ -192,7 +429,36 @@ func (pc *ParameterContents) Decode(reader *asn1.ASNReader) errors.Error {
 			return errors.Update(err)
 		}
 		index := uint8(peek) - asn1.Context(0)
-		if index < 18 {
+		if index == streamDescriptorCtx {
+			_, descriptorReader, err := reader.ReadSequenceStart(peek)
+			if err != nil {
+				return errors.Update(err)
+			}
+			descriptor := &StreamDescription{}
+			err = descriptor.Decode(descriptorReader)
+			if err != nil {
+				return errors.Update(err)
+			}
+			pc.streamDescriptor = descriptor
+			err = descriptorReader.ReadSequenceEnd()
+			if err != nil {
+				return errors.Update(err)
+			}
+		} else if index == enumMapCtx {
+			_, enumMapReader, err := reader.ReadSequenceStart(peek)
+			if err != nil {
+				return errors.Update(err)
+			}
+			enumMap, err := decodeEnumMap(enumMapReader)
+			if err != nil {
+				return errors.Update(err)
+			}
+			pc.enumMap = enumMap
+			err = enumMapReader.ReadSequenceEnd()
+			if err != nil {
+				return errors.Update(err)
+			}
+		} else if index < 18 {
 			value, err = DecodeValue(reader, index)
 			if err != nil {
 				return errors.Update(err)
@@ -236,11 +502,11 @@ func (contents *ParameterContents) ToString() string {
 	}
 	valObject := contents.GetValueObject()
 	if valObject != nil && valObject.isSet {
-		str = fmt.Sprintf("%  svalue: %s\n",str, valObject.ToString())
+		str = fmt.Sprintf("%s  value: %s\n",str, valObject.ToString())
 	}
 	valObject = contents.GetMinimumObject()
 	if valObject != nil && valObject.isSet {
-		str = fmt.Sprintf("%  sminimum: %s\n",str, valObject.ToString())
+		str = fmt.Sprintf("%s  minimum: %s\n",str, valObject.ToString())
 	}
 	valObject = contents.GetMaximumObject()
 	if valObject != nil && valObject.isSet {
@@ -250,9 +516,9 @@ func (contents *ParameterContents) ToString() string {
 	if valObject != nil && valObject.isSet {
 		str = fmt.Sprintf("%s  default: %s\n",str, valObject.ToString())
 	}
-	valStr,err = contents.GetAccess()
-	if err != nil {
-		str = fmt.Sprintf("%s  access: %s\n",str,valStr)
+	access,err := contents.GetAccess()
+	if err == nil {
+		str = fmt.Sprintf("%s  access: %s\n",str,access)
 	}
 	valStr,err = contents.GetFormat()
 	if err != nil {
@@ -264,11 +530,11 @@ func (contents *ParameterContents) ToString() string {
 	}
 	valInt,err := contents.GetFactor()
 	if err != nil {
-		str = fmt.Sprintf("%s  factor: %ll\n",str,valInt)
+		str = fmt.Sprintf("%s  factor: %d\n",str,valInt)
 	}
 	valInt,err = contents.GetStep()
 	if err != nil {
-		str = fmt.Sprintf("%s  step: %ll\n",str,valInt)
+		str = fmt.Sprintf("%s  step: %d\n",str,valInt)
 	}
 	valBool,err := contents.GetOnline()
 	if err != nil {
@@ -278,13 +544,13 @@ func (contents *ParameterContents) ToString() string {
 			str = fmt.Sprintf("%s  isonline: false\n",str)
 		}
 	}
-	valStr,err = contents.GetType()
-	if err != nil {
-		str = fmt.Sprintf("%s  type: %s\n",str,valStr)
+	ptype,err := contents.GetType()
+	if err == nil {
+		str = fmt.Sprintf("%s  type: %s\n",str,ptype)
 	}
 	valInt,err = contents.GetStreamIdentifier()
 	if err != nil {
-		str = fmt.Sprintf("%s  streamIdentifier: %ll\n",str,valInt)
+		str = fmt.Sprintf("%s  streamIdentifier: %d\n",str,valInt)
 	}
 	return fmt.Sprintf("{\n%s}\n", str)
 }
\ No newline at end of file
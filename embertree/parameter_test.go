@@ -99,3 +99,90 @@ func TestDecodeParameterValue(t *testing.T) {
 		return
 	}
 }
+
+// roundTrip encodes element and decodes it as a provider update.
+func roundTrip(t *testing.T, element *embertree.Element) *embertree.Element {
+	writer := asn1.NewASNWriter()
+	err := element.Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	decoded, err := embertree.DecodeElement(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return decoded
+}
+
+func TestParameterSparseUpdate(t *testing.T) {
+	parameter := embertree.NewParameter(1)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.SetIdentifier("gain")
+	contents.SetDescription("Input gain")
+	contents.GetMinimumObject().SetInt(-10)
+	contents.GetMaximumObject().SetInt(10)
+	contents.GetValueObject().SetInt(0)
+
+	update := embertree.NewParameter(1)
+	update.CreateContent().(*embertree.ParameterContents).GetValueObject().SetInt(5)
+	err := parameter.Update(roundTrip(t, update))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	contents = parameter.GetContent().(*embertree.ParameterContents)
+	value, _ := contents.GetValueObject().GetInt()
+	identifier, _ := contents.GetIdentifier()
+	description, _ := contents.GetDescription()
+	minimum, _ := contents.GetMinimumObject().GetInt()
+	maximum, _ := contents.GetMaximumObject().GetInt()
+	if value != 5 || identifier != "gain" || description != "Input gain" || minimum != -10 || maximum != 10 {
+		t.Errorf("Invalid merge: value %d identifier %s description %s min %d max %d", value, identifier, description, minimum, maximum)
+	}
+}
+
+func TestParameterAccessAndType(t *testing.T) {
+	parameter := embertree.NewParameter(1)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.SetAccess(embertree.ParameterAccessReadWrite)
+	contents.SetType(embertree.ParameterTypeReal)
+	contents = roundTrip(t, parameter).GetContent().(*embertree.ParameterContents)
+	access, err := contents.GetAccess()
+	if err != nil || access != embertree.ParameterAccessReadWrite {
+		t.Errorf("Unexpected access %s", access)
+	}
+	ptype, err := contents.GetType()
+	if err != nil || ptype != embertree.ParameterTypeReal {
+		t.Errorf("Unexpected type %s", ptype)
+	}
+	if contents.GetValueType() != embertree.ValueTypeReal {
+		t.Errorf("Unexpected value type %s", embertree.ValueType2String(contents.GetValueType()))
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	contents := embertree.NewParameterContents().(*embertree.ParameterContents)
+	contents.SetType(embertree.ParameterTypeInteger)
+	contents.GetMinimumObject().SetInt(-10)
+	contents.GetMaximumObject().SetInt(10)
+	contents.SetStep(5)
+	if err := contents.ValidateValue(5); err == nil {
+		t.Error("Write to a parameter without access accepted")
+	}
+	contents.SetAccess(embertree.ParameterAccessReadWrite)
+	for _, value := range []interface{}{-10, 0, 5, 10} {
+		if err := contents.ValidateValue(value); err != nil {
+			t.Errorf("Value %v rejected. %s", value, err.Message)
+		}
+	}
+	for _, value := range []interface{}{-15, 15, 3, "loud", true} {
+		if err := contents.ValidateValue(value); err == nil {
+			t.Errorf("Value %v accepted", value)
+		}
+	}
+	contents.SetAccess(embertree.ParameterAccessRead)
+	if err := contents.ValidateValue(5); err == nil {
+		t.Error("Write to a read only parameter accepted")
+	}
+}
@@ -9,12 +9,28 @@ var QualifiedParameterApplication = asn1.Application(9)
 var QualifiedNodeApplication = asn1.Application(10)
 var QualifiedMatrixApplication = asn1.Application(17)
 var QualifiedFunctionApplication = asn1.Application(20)
+var QualifiedTemplateApplication = asn1.Application(25)
 
 var qualifiedTags = map[uint8]bool{
 	QualifiedParameterApplication: true,
 	QualifiedNodeApplication:      true,
 	QualifiedMatrixApplication:    true,
-	QualifiedFunctionApplication:  true}
+	QualifiedFunctionApplication:  true,
+	QualifiedTemplateApplication:  true}
+
+var qualifiedTagMap = map[uint8]uint8{
+	ParameterApplication: QualifiedParameterApplication,
+	NodeApplication:      QualifiedNodeApplication,
+	MatrixApplication:    QualifiedMatrixApplication,
+	FunctionApplication:  QualifiedFunctionApplication,
+	TemplateApplication:  QualifiedTemplateApplication}
+
+var unqualifiedTagMap = map[uint8]uint8{
+	QualifiedParameterApplication: ParameterApplication,
+	QualifiedNodeApplication:      NodeApplication,
+	QualifiedMatrixApplication:    MatrixApplication,
+	QualifiedFunctionApplication:  FunctionApplication,
+	QualifiedTemplateApplication:  TemplateApplication}
 
 
 func getNumberFromPath(path asn1.RelativeOID) (int, errors.Error) {
@@ -48,30 +64,124 @@ func NewQualifiedMatrix(path asn1.RelativeOID, mtype MatrixType, mode MatrixMode
 	return q
 }
 
+func NewQualifiedFunction(path asn1.RelativeOID) *Element {
+	return NewQualifiedElement(QualifiedFunctionApplication, path, NewFunctionContents)
+}
+
+func NewQualifiedTemplate(path asn1.RelativeOID) *Element {
+	return NewQualifiedElement(QualifiedTemplateApplication, path, NewTemplateContents)
+}
+
 func IsQualifiedTag(tag uint8) bool {
 	return qualifiedTags[tag] == true
 }
 
+// GetQualifiedTag returns the qualified application tag matching tag.
+// Tags without a qualified variant are returned unchanged.
+func GetQualifiedTag(tag uint8) uint8 {
+	qtag, ok := qualifiedTagMap[tag]
+	if !ok {
+		return tag
+	}
+	return qtag
+}
+
+// GetUnqualifiedTag returns the application tag of the non qualified variant of tag.
+func GetUnqualifiedTag(tag uint8) uint8 {
+	utag, ok := unqualifiedTagMap[tag]
+	if !ok {
+		return tag
+	}
+	return utag
+}
+
+// GetPath returns the path of the element. It is not cached for unqualified
+// elements so it can be read while the tree is being updated.
 func (element *Element) GetPath() asn1.RelativeOID {
-	if len(element.path) <= 0 {
-		var parentPath = asn1.RelativeOID{}
-		if element.parent != nil {
-			parentPath = element.parent.GetPath()
-		}
-		element.path = append(parentPath, int32(element.Number))
+	if len(element.path) > 0 {
+		return element.path
 	}
-	return element.path
+	var parentPath = asn1.RelativeOID{}
+	if element.parent != nil {
+		parentPath = element.parent.GetPath()
+	}
+	path := make(asn1.RelativeOID, len(parentPath), len(parentPath)+1)
+	copy(path, parentPath)
+	return append(path, int32(element.Number))
 }
 
-func (element *Element) GetQualifiedDirectoryMsg(listener Listener) *RootElement {
+// getQualifiedCommandMsg builds a message sending command to the qualified
+// version of the element.
+func (element *Element) getQualifiedCommandMsg(command *Element) *RootElement {
 	path := element.GetPath()
-	dupElement := NewQualifiedElement(element.tag, path, nil)
-	cmd := NewCommand(COMMAND_GETDIRECTORY)
-	dupElement.AddChild(cmd)
+	dupElement := NewQualifiedElement(GetQualifiedTag(element.tag), path, nil)
+	dupElement.isMatrix = element.isMatrix
+	dupElement.AddChild(command)
 	root := NewRoot()
 	root.AddElement(dupElement)
+	return root
+}
+
+func (element *Element) GetQualifiedDirectoryMsg(listener Listener) *RootElement {
+	root := element.getQualifiedCommandMsg(NewCommand(COMMAND_GETDIRECTORY))
 	if listener != nil {
 		element.AddListener(listener)
 	}
 	return root
 }
+
+// GetSubscribeMsg builds the message subscribing to a stream parameter or a matrix.
+func (element *Element) GetSubscribeMsg() (*RootElement, errors.Error) {
+	if !element.isSubscribable() {
+		return nil, errors.New("Element %s is neither a parameter nor a matrix.", Path2String(element.GetPath()))
+	}
+	return element.getQualifiedCommandMsg(NewCommand(COMMAND_SUBSCRIBE)), nil
+}
+
+// GetUnsubscribeMsg builds the message cancelling a subscription.
+func (element *Element) GetUnsubscribeMsg() (*RootElement, errors.Error) {
+	if !element.isSubscribable() {
+		return nil, errors.New("Element %s is neither a parameter nor a matrix.", Path2String(element.GetPath()))
+	}
+	return element.getQualifiedCommandMsg(NewCommand(COMMAND_UNSUBSCRIBE)), nil
+}
+
+func (element *Element) isSubscribable() bool {
+	tag := GetUnqualifiedTag(element.tag)
+	return tag == ParameterApplication || tag == MatrixApplication
+}
+
+// getMinimalCopy duplicates the element number, contents and matrix signals
+// without its children. The contents are shared with the original element.
+func (element *Element) getMinimalCopy() *Element {
+	dupElement := NewElement(element.tag, element.Number, element.contentsCreator)
+	dupElement.contents = element.contents
+	dupElement.isMatrix = element.isMatrix
+	dupElement.targets = element.targets
+	dupElement.sources = element.sources
+	dupElement.connections = element.connections
+	return dupElement
+}
+
+// GetQualifiedCopy returns a qualified version of the element with its contents
+// and a minimal copy of its direct children.
+func (element *Element) GetQualifiedCopy() *Element {
+	dupElement := NewQualifiedElement(GetQualifiedTag(element.tag), element.GetPath(), element.contentsCreator)
+	dupElement.contents = element.contents
+	dupElement.isMatrix = element.isMatrix
+	dupElement.targets = element.targets
+	dupElement.sources = element.sources
+	dupElement.connections = element.connections
+	for _, child := range element.Children {
+		dupElement.AddChild(child.getMinimalCopy())
+	}
+	return dupElement
+}
+
+// GetDirectoryResponse builds the message a provider sends back when receiving
+// a GetDirectory command for this element.
+func (element *Element) GetDirectoryResponse() *RootElement {
+	root := NewRoot()
+	root.AddElement(element.GetQualifiedCopy())
+	return root
+}
@@ -41,3 +41,55 @@ func TestDecodeQualifiedNode(t *testing.T) {
 		}
 	}
 }
+
+func TestGetQualifiedTag(t *testing.T) {
+	if embertree.GetQualifiedTag(embertree.NodeApplication) != embertree.QualifiedNodeApplication {
+		t.Errorf("GetQualifiedTag failed for Node")
+	}
+	if embertree.GetQualifiedTag(embertree.QualifiedNodeApplication) != embertree.QualifiedNodeApplication {
+		t.Errorf("GetQualifiedTag failed for QualifiedNode")
+	}
+	if embertree.GetUnqualifiedTag(embertree.QualifiedFunctionApplication) != embertree.FunctionApplication {
+		t.Errorf("GetUnqualifiedTag failed for QualifiedFunction")
+	}
+}
+
+func TestGetDirectoryResponse(t *testing.T) {
+	node := embertree.NewNode(1)
+	node.CreateContent().(*embertree.NodeContents).SetIdentifier("gdnet")
+	child := embertree.NewNode(2)
+	grandChild := embertree.NewParameter(3)
+	child.AddChild(grandChild)
+	node.AddChild(child)
+	response := child.GetDirectoryResponse()
+	writer := asn1.NewASNWriter()
+	err := response.Encode(writer)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	elements, err := embertree.DecodeRootElementCollection(asn1.NewASNReader(b))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(elements) != 1 || elements[0].GetTag() != embertree.QualifiedNodeApplication {
+		t.Errorf("Invalid GetDirectory response")
+		return
+	}
+	path := elements[0].GetPath()
+	if len(path) != 2 || path[0] != 1 || path[1] != 2 {
+		t.Errorf("Invalid GetDirectory response path %s", embertree.Path2String(path))
+		return
+	}
+	qchild := elements[0].Children[3]
+	if qchild == nil {
+		t.Errorf("Missing child in GetDirectory response")
+		return
+	}
+	if embertree.Path2String(qchild.GetPath()) != "1.2.3" {
+		t.Errorf("Invalid child path %s", embertree.Path2String(qchild.GetPath()))
+	}
+}
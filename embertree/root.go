@@ -2,6 +2,8 @@ package embertree
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/dufourgilles/emberlib/errors"
 	. "github.com/dufourgilles/emberlib/logger"
@@ -12,24 +14,92 @@ type RootElement struct {
 	RootElementCollection map[int]*Element
 	logger Logger
 	listeners             map[Listener]Listener
+	invocationListeners   map[int]Listener
+	listenersLock         sync.Mutex
+	invocationResult      *InvocationResult
+	streams               []*StreamEntry
+	// index is only maintained for the trees created with NewTree.
+	index                 *treeIndex
 }
 
 func NewTree() *RootElement {
 	return &RootElement{
 		listeners:             make(map[Listener]Listener),
+		invocationListeners:   make(map[int]Listener),
 		RootElementCollection: make(map[int]*Element),
 		logger: NewNullLogger(),
+		index:                 newTreeIndex(),
 	}
 }
 
+// NewInvocationResultRoot creates the root message sent by a provider to return
+// the result of an invocation.
+func NewInvocationResultRoot(result *InvocationResult) *RootElement {
+	root := NewRoot()
+	root.invocationResult = result
+	return root
+}
+
 func NewRoot() *RootElement {
 	return &RootElement{listeners: nil, RootElementCollection: make(map[int]*Element)}
 }
 
+// NewStreamRoot creates the root message sent by a provider to update streams.
+func NewStreamRoot(entries []*StreamEntry) *RootElement {
+	root := NewRoot()
+	root.streams = entries
+	return root
+}
+
 func (root *RootElement) GetElementByNumber(number int) *Element {
 	return root.RootElementCollection[number]
 }
 
+// GetElementByIdentifier returns the root element with identifier or nil.
+func (root *RootElement) GetElementByIdentifier(identifier string) *Element {
+	if root.index != nil {
+		element := root.index.byIdentifierPath[identifier]
+		if element != nil && element.parent == nil && root.isAttached(element) {
+			return element
+		}
+	}
+	return getChildByIdentifier(root.RootElementCollection, identifier)
+}
+
+// GetElementByIdentifierPath returns the element at the path of identifiers
+// separated by "/", like "Router/Matrices/Video", or nil.
+func (root *RootElement) GetElementByIdentifierPath(path string) *Element {
+	identifiers := SplitIdentifierPath(path)
+	if len(identifiers) == 0 {
+		return nil
+	}
+	if root.index != nil {
+		element := root.index.byIdentifierPath[strings.Join(identifiers, "/")]
+		if element != nil && root.isAttached(element) {
+			return element
+		}
+	}
+	element := root.GetElementByIdentifier(identifiers[0])
+	for _, identifier := range identifiers[1:] {
+		if element == nil {
+			return nil
+		}
+		element = element.GetChildByIdentifier(identifier)
+	}
+	return element
+}
+
+// SplitIdentifierPath returns the identifiers of a path like "Router/Matrices/Video".
+func SplitIdentifierPath(path string) []string {
+	identifiers := []string{}
+	for _, identifier := range strings.Split(path, "/") {
+		if identifier != "" {
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	return identifiers
+}
+
 func (root *RootElement)SetLogger(logger Logger) {
 	if logger != nil {
 		root.logger = logger
@@ -40,6 +110,12 @@ func (root *RootElement) GetElementByPath(path asn1.RelativeOID) (*Element,*Elem
 	if len(path) <= 0 {
 		 return nil,nil
 	}
+	if root.index != nil {
+		element := root.index.byPath[Path2String(path)]
+		if element != nil && root.isAttached(element) {
+			return element.parent, element
+		}
+	}
 	pos := 0
 	var parent *Element
 	parent = nil
@@ -48,7 +124,7 @@ func (root *RootElement) GetElementByPath(path asn1.RelativeOID) (*Element,*Elem
 		parent = element
 		element = element.Children[int(path[pos])]
 	}
-	if pos + 1 < len(path) {
+	if element == nil && pos < len(path) {
 		return nil,nil
 	}
 	return parent,element
@@ -81,8 +157,66 @@ func (root *RootElement) updateElement(element *Element) errors.Error {
 	return err
 }
 
+func decodeElementCollection(reader *asn1.ASNReader) ([]*Element, errors.Error) {
+	elements := []*Element{}
+	_, collectionReader, err := reader.ReadSequenceStart(asn1.Application(11))
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	for collectionReader.Len() > 0 {
+		_, elementReader, err := collectionReader.ReadSequenceStart(asn1.Context(0))
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		element, err := DecodeElement(elementReader)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		elements = append(elements, element)
+		err = elementReader.ReadSequenceEnd()
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		end, err := collectionReader.CheckSequenceEnd()
+		if end {
+			break
+		}
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	}
+	return elements, nil
+}
+
+// DecodeRootElementCollection decodes an encoded root and returns its elements
+// as received, without merging them into a tree.
+func DecodeRootElementCollection(reader *asn1.ASNReader) ([]*Element, errors.Error) {
+	elements := []*Element{}
+	_, reader, err := reader.ReadSequenceStart(asn1.Application(0))
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	peek, err := reader.Peek()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	if peek == asn1.Application(11) {
+		elements, err = decodeElementCollection(reader)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	}
+	return elements, errors.Update(reader.ReadSequenceEnd())
+}
+
 func (root *RootElement) Decode(reader *asn1.ASNReader) errors.Error {
-	modifiedElement := make(map[string]*Element)
+	rootEvent := &ChangeEvent{}
+	// Root listeners are not called for messages only holding qualified updates
+	// deeper in the tree. Root level elements, qualified or not, and empty
+	// messages notify them.
+	rootUpdated := false
+	deepUpdated := false
+	modifiedElement := make(map[string]*ChangeEvent)
 	_, reader, err := reader.ReadSequenceStart(asn1.Application(0))
 	if err != nil {
 		return err
@@ -91,58 +225,85 @@ func (root *RootElement) Decode(reader *asn1.ASNReader) errors.Error {
 	if err != nil {
 		return err
 	}
+	if peek == InvocationResultApplication {
+		result := &InvocationResult{}
+		err = result.Decode(reader)
+		if err != nil {
+			return errors.Update(err)
+		}
+		root.invocationResultReceived(result)
+		return errors.Update(reader.ReadSequenceEnd())
+	}
+	if peek == StreamCollectionApplication || peek == StreamEntryApplication {
+		var entries []*StreamEntry
+		if peek == StreamEntryApplication {
+			// Not a valid Glow root but some providers send a single entry.
+			entry := &StreamEntry{}
+			err = entry.Decode(reader)
+			entries = []*StreamEntry{entry}
+		} else {
+			entries, err = decodeStreamCollection(reader)
+		}
+		if err != nil {
+			return errors.Update(err)
+		}
+		root.updateStreams(entries)
+		return errors.Update(reader.ReadSequenceEnd())
+	}
 	if peek == asn1.Application(11) {
-		_, collectionReader, err := reader.ReadSequenceStart(peek)
+		elements, err := decodeElementCollection(reader)
 		if err != nil {
 			return errors.Update(err)
 		}
-		for collectionReader.Len() > 0 {
-			_, elementReader, err := collectionReader.ReadSequenceStart(asn1.Context(0))
-			if err != nil {
-				return errors.Update(err)
-			}
-			element, err := DecodeElement(elementReader)
-			if err != nil {
-				return errors.Update(err)
-			}
+		for _, element := range elements {
 			root.logger.Debug("Updating E/QE %s.\n", Path2String(element.GetPath()))
 			if element.isQualified && len(element.path) > 1 {
+				deepUpdated = true
 				parent,err := root.updateQualifiedElement(element)
 				if err == nil && parent != nil {
-					modifiedElement[Path2String(parent.GetPath())] = parent
+					path := Path2String(parent.GetPath())
+					if modifiedElement[path] == nil {
+						modifiedElement[path] = &ChangeEvent{Element: parent}
+					}
+					modifiedElement[path].AddedChildren = append(modifiedElement[path].AddedChildren, element)
 				}
 			} else {
+				rootUpdated = true
+				if root.GetElementByNumber(element.Number) == nil {
+					rootEvent.AddedChildren = append(rootEvent.AddedChildren, element)
+				}
 				root.updateElement(element)
 			}
-			err = elementReader.ReadSequenceEnd()
-			if err != nil {
-				return errors.Update(err)
-			}
-			end, err := collectionReader.CheckSequenceEnd()
-			if end {
-				break
-			}
-			if err != nil {
-				return errors.Update(err)
-			}
 		}
 	}
 	err = reader.ReadSequenceEnd()
-	for _, listener := range(root.listeners) {
-		root.logger.Debug("Updating root listener.\n")
-		listener.Receive(root, nil)
+	if rootUpdated || !deepUpdated {
+		root.logger.Debug("Updating root listeners.\n")
+		notifyListeners(root.getListeners(), root, rootEvent, nil)
 	}
-	for path,mElement := range(modifiedElement) {
-		for _,listener := range(mElement.listeners) {
-			root.logger.Debug("Updating Element %s listener.\n", path)
-			listener.Receive(mElement, nil)
-		}
+	for path,event := range(modifiedElement) {
+		root.logger.Debug("Updating Element %s listeners.\n", path)
+		event.Element.updateListeners(event, nil)
 	}
 	return errors.Update(err)
 }
 
 func (root *RootElement) Encode(writer *asn1.ASNWriter) errors.Error {
 	writer.StartSequence(asn1.Application(0))
+	if root.invocationResult != nil {
+		err := root.invocationResult.Encode(writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		return writer.EndSequence()
+	}
+	if root.streams != nil {
+		err := encodeStreamCollection(root.streams, writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		return writer.EndSequence()
+	}
 	if len(root.RootElementCollection) > 0 {
 		writer.StartSequence(asn1.Application(11))
 		for _, element := range root.RootElementCollection {
@@ -163,30 +324,134 @@ func (root *RootElement) Encode(writer *asn1.ASNWriter) errors.Error {
 
 func (root *RootElement) AddElement(element *Element) {
 	root.RootElementCollection[element.Number] = element	
+	element.root = root
+	root.indexElement(element, true)
+}
+
+// indexElement indexes element, and its subtree if subtree is set.
+func (root *RootElement) indexElement(element *Element, subtree bool) {
+	if root.index != nil {
+		root.index.add(element, subtree)
+	}
+}
+
+// GetDirectoryResponse builds the message a provider sends back when receiving
+// a GetDirectory command for the root.
+func (root *RootElement) GetDirectoryResponse() *RootElement {
+	response := NewRoot()
+	for _, element := range root.RootElementCollection {
+		response.AddElement(element.getMinimalCopy())
+	}
+	return response
 }
 
 func (r *RootElement) GetDirectoryMsg(listener Listener) (*RootElement, errors.Error) {
 	root := NewRoot()
 	cmd := NewCommand(COMMAND_GETDIRECTORY)
 	root.AddElement(cmd)
-	r.AddListener(listener)
+	if listener != nil {
+		r.AddListener(listener)
+	}
 	return root, nil
 }
 
+// getStreamParameters returns the parameters using the given stream identifier.
+func (root *RootElement) getStreamParameters(element *Element, streamIdentifier int, parameters []*Element) []*Element {
+	if contents, ok := element.contents.(*ParameterContents); ok {
+		id, err := contents.GetStreamIdentifier()
+		if err == nil && int(id) == streamIdentifier {
+			parameters = append(parameters, element)
+		}
+	}
+	for _, child := range element.Children {
+		parameters = root.getStreamParameters(child, streamIdentifier, parameters)
+	}
+	return parameters
+}
+
+// updateStreams sets the values of the parameters matching the stream entries and
+// calls their listeners. Octet string streams are unpacked with the stream descriptor
+// of each parameter.
+func (root *RootElement) updateStreams(entries []*StreamEntry) {
+	for _, entry := range entries {
+		if entry.Value == nil {
+			continue
+		}
+		for _, parameter := range root.GetStreamParameters(entry.StreamIdentifier) {
+			contents := parameter.contents.(*ParameterContents)
+			value := entry.Value
+			descriptor := contents.GetStreamDescriptor()
+			if descriptor != nil && value.GetType() == ValueTypeBuffer {
+				var err errors.Error
+				value, err = descriptor.Extract(value.bufferVal)
+				if err != nil {
+					root.logger.Error(err)
+					continue
+				}
+			}
+			changes := contents.table[valueCtx].mergeField(parameterFieldNames[valueCtx], value, nil)
+			parameter.updateListeners(&ChangeEvent{Element: parameter, Fields: changes}, nil)
+		}
+	}
+}
+
+// AddInvocationListener registers a listener receiving the InvocationResult
+// with the given invocation id. The listener is removed once called.
+func (r *RootElement) AddInvocationListener(id int, listener Listener) {
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
+	r.invocationListeners[id] = listener
+}
+
+func (r *RootElement) RemoveInvocationListener(id int) {
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
+	delete(r.invocationListeners, id)
+}
+
+func (r *RootElement) invocationResultReceived(result *InvocationResult) {
+	r.listenersLock.Lock()
+	listener := r.invocationListeners[result.GetID()]
+	delete(r.invocationListeners, result.GetID())
+	r.listenersLock.Unlock()
+	if listener == nil {
+		r.logger.Debug("No listener for invocation %d.\n", result.GetID())
+		return
+	}
+	listener.Receive(result, nil)
+}
+
 func (r *RootElement) AddListener(listener Listener) {
 	r.logger.Debug("Adding Root Listener.\n")
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
 	r.listeners[listener] = listener
 }
 
 func (r *RootElement) RemoveListener(listener Listener) {
 	r.logger.Debug("Removing Root Listener.\n")
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
 	delete(r.listeners, listener)
 }
 
 func (r *RootElement) HasListner(listener Listener) bool {
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
 	return r.listeners[listener] != nil
 }
 
+// getListeners returns a copy of the root listeners.
+func (r *RootElement) getListeners() []Listener {
+	r.listenersLock.Lock()
+	defer r.listenersLock.Unlock()
+	listeners := make([]Listener, 0, len(r.listeners))
+	for _, listener := range r.listeners {
+		listeners = append(listeners, listener)
+	}
+	return listeners
+}
+
 func (root *RootElement) ToString() string {
 	str := ""
 	for _,element := range(root.RootElementCollection) {
@@ -195,4 +195,100 @@ func TestListeners(t *testing.T) {
 	if root.HasListner(&listener) {
 		t.Errorf("Remove Listener failed")
 	}
-}
\ No newline at end of file
+}
+func TestRootGetDirectoryResponse(t *testing.T) {
+	root := embertree.NewTree()
+	node := embertree.NewNode(10)
+	node.CreateContent().(*embertree.NodeContents).SetIdentifier("gdnet")
+	node.AddChild(embertree.NewParameter(1))
+	root.AddElement(node)
+	response := root.GetDirectoryResponse()
+	element := response.GetElementByNumber(10)
+	if element == nil {
+		t.Errorf("Missing element 10 in response")
+		return
+	}
+	if len(element.Children) != 0 {
+		t.Errorf("Root GetDirectory response should not contain children")
+	}
+	if element.GetContent() == nil {
+		t.Errorf("Root GetDirectory response without contents")
+	}
+}
+
+func TestGetElementByPathMissingBranch(t *testing.T) {
+	root := embertree.NewTree()
+	node := embertree.NewNode(1)
+	root.AddElement(node)
+	parent, element := root.GetElementByPath(asn1.RelativeOID{1, 2, 3})
+	if parent != nil || element != nil {
+		t.Errorf("Unexpected element for a path with a missing branch")
+	}
+	parent, element = root.GetElementByPath(asn1.RelativeOID{1, 2})
+	if parent != node || element != nil {
+		t.Errorf("Expected parent without element")
+	}
+}
+
+func TestGetElementByIdentifierPath(t *testing.T) {
+	root := embertree.NewTree()
+	router := embertree.NewNode(3)
+	router.CreateContent().(*embertree.NodeContents).SetIdentifier("Router")
+	matrices := embertree.NewNode(1)
+	matrices.CreateContent().(*embertree.NodeContents).SetIdentifier("Matrices")
+	video, _ := embertree.NewMatrix(4, embertree.OneToN, embertree.Linear)
+	video.GetContent().(*embertree.MatrixContent).SetIdentifier("Video")
+	unnamed := embertree.NewNode(5)
+	matrices.AddChild(unnamed)
+	matrices.AddChild(video)
+	router.AddChild(matrices)
+	root.AddElement(router)
+
+	element := root.GetElementByIdentifierPath("/Router/Matrices/Video")
+	if element != video {
+		t.Fatal("Video matrix not found")
+	}
+	if embertree.Path2String(element.GetPath()) != "3.1.4" {
+		t.Errorf("Unexpected path %s", embertree.Path2String(element.GetPath()))
+	}
+	if root.GetElementByIdentifierPath("Router/Video") != nil || root.GetElementByIdentifierPath("") != nil {
+		t.Errorf("Unexpected element for an invalid path")
+	}
+	if _, err := unnamed.GetIdentifier(); err == nil {
+		t.Errorf("Expected an error for an element without contents")
+	}
+}
+
+func TestRootListenerQualifiedUpdate(t *testing.T) {
+	tree := embertree.NewTree()
+	message := embertree.NewRoot()
+	node := embertree.NewNode(1)
+	node.AddChild(embertree.NewParameter(1))
+	message.AddElement(node)
+	decodeRoot(t, tree, message)
+
+	listener := &listenerTest{}
+	tree.AddListener(listener)
+	update := embertree.NewRoot()
+	parameter := embertree.NewQualifiedParameter(asn1.RelativeOID{1, 1})
+	parameter.CreateContent().(*embertree.ParameterContents).GetValueObject().SetInt(5)
+	update.AddElement(parameter)
+	decodeRoot(t, tree, update)
+	if listener.el != nil {
+		t.Error("Root listener called for a qualified update")
+	}
+
+	decodeRoot(t, tree, message)
+	if listener.el != tree {
+		t.Error("Root listener not called for root elements")
+	}
+
+	// A repeated root directory answered with existing qualified root elements.
+	listener.el = nil
+	qualified := embertree.NewRoot()
+	qualified.AddElement(embertree.NewQualifiedNode(asn1.RelativeOID{1}))
+	decodeRoot(t, tree, qualified)
+	if listener.el != tree {
+		t.Error("Root listener not called for qualified root elements")
+	}
+}
@@ -0,0 +1,321 @@
+package embertree
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+var StreamEntryApplication = asn1.Application(5)
+var StreamCollectionApplication = asn1.Application(6)
+var StreamDescriptionApplication = asn1.Application(12)
+
+type StreamFormat int
+
+const (
+	StreamFormatUInt8               StreamFormat = 0
+	StreamFormatUInt16BigEndian     StreamFormat = 2
+	StreamFormatUInt16LittleEndian  StreamFormat = 3
+	StreamFormatUInt32BigEndian     StreamFormat = 4
+	StreamFormatUInt32LittleEndian  StreamFormat = 5
+	StreamFormatUInt64BigEndian     StreamFormat = 6
+	StreamFormatUInt64LittleEndian  StreamFormat = 7
+	StreamFormatInt8                StreamFormat = 8
+	StreamFormatInt16BigEndian      StreamFormat = 10
+	StreamFormatInt16LittleEndian   StreamFormat = 11
+	StreamFormatInt32BigEndian      StreamFormat = 12
+	StreamFormatInt32LittleEndian   StreamFormat = 13
+	StreamFormatInt64BigEndian      StreamFormat = 14
+	StreamFormatInt64LittleEndian   StreamFormat = 15
+	StreamFormatFloat32BigEndian    StreamFormat = 20
+	StreamFormatFloat32LittleEndian StreamFormat = 21
+	StreamFormatFloat64BigEndian    StreamFormat = 22
+	StreamFormatFloat64LittleEndian StreamFormat = 23
+)
+
+// StreamDescription tells how the value of a parameter is extracted from an
+// octet string stream.
+type StreamDescription struct {
+	Format StreamFormat
+	Offset int
+}
+
+func NewStreamDescription(format StreamFormat, offset int) *StreamDescription {
+	return &StreamDescription{Format: format, Offset: offset}
+}
+
+// size returns the number of bytes used by the format.
+func (d *StreamDescription) size() int {
+	switch d.Format {
+	case StreamFormatUInt8, StreamFormatInt8:
+		return 1
+	case StreamFormatUInt16BigEndian, StreamFormatUInt16LittleEndian, StreamFormatInt16BigEndian, StreamFormatInt16LittleEndian:
+		return 2
+	case StreamFormatUInt32BigEndian, StreamFormatUInt32LittleEndian, StreamFormatInt32BigEndian, StreamFormatInt32LittleEndian,
+		StreamFormatFloat32BigEndian, StreamFormatFloat32LittleEndian:
+		return 4
+	case StreamFormatUInt64BigEndian, StreamFormatUInt64LittleEndian, StreamFormatInt64BigEndian, StreamFormatInt64LittleEndian,
+		StreamFormatFloat64BigEndian, StreamFormatFloat64LittleEndian:
+		return 8
+	}
+	return 0
+}
+
+// byteOrder returns the byte order of multi bytes formats.
+func (d *StreamDescription) byteOrder() binary.ByteOrder {
+	switch d.Format {
+	case StreamFormatUInt16LittleEndian, StreamFormatUInt32LittleEndian, StreamFormatUInt64LittleEndian,
+		StreamFormatInt16LittleEndian, StreamFormatInt32LittleEndian, StreamFormatInt64LittleEndian,
+		StreamFormatFloat32LittleEndian, StreamFormatFloat64LittleEndian:
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}
+
+// Extract reads the value described by d from an octet string stream.
+// Integer formats return an integer value and float formats a real value.
+func (d *StreamDescription) Extract(stream []byte) (*ContentParameter, errors.Error) {
+	size := d.size()
+	if size == 0 {
+		return nil, errors.New("Unknown stream format %d.", d.Format)
+	}
+	if d.Offset < 0 || d.Offset+size > len(stream) {
+		return nil, errors.New("Stream offset %d out of range. Stream length %d.", d.Offset, len(stream))
+	}
+	data := stream[d.Offset : d.Offset+size]
+	order := d.byteOrder()
+	value := NewContentParameter()
+	switch d.Format {
+	case StreamFormatUInt8:
+		value.SetInt(int64(data[0]))
+	case StreamFormatInt8:
+		value.SetInt(int64(int8(data[0])))
+	case StreamFormatUInt16BigEndian, StreamFormatUInt16LittleEndian:
+		value.SetInt(int64(order.Uint16(data)))
+	case StreamFormatInt16BigEndian, StreamFormatInt16LittleEndian:
+		value.SetInt(int64(int16(order.Uint16(data))))
+	case StreamFormatUInt32BigEndian, StreamFormatUInt32LittleEndian:
+		value.SetInt(int64(order.Uint32(data)))
+	case StreamFormatInt32BigEndian, StreamFormatInt32LittleEndian:
+		value.SetInt(int64(int32(order.Uint32(data))))
+	case StreamFormatUInt64BigEndian, StreamFormatUInt64LittleEndian, StreamFormatInt64BigEndian, StreamFormatInt64LittleEndian:
+		value.SetInt(int64(order.Uint64(data)))
+	case StreamFormatFloat32BigEndian, StreamFormatFloat32LittleEndian:
+		value.SetReal(float64(math.Float32frombits(order.Uint32(data))))
+	case StreamFormatFloat64BigEndian, StreamFormatFloat64LittleEndian:
+		value.SetReal(math.Float64frombits(order.Uint64(data)))
+	}
+	return value, nil
+}
+
+func (d *StreamDescription) Encode(writer *asn1.ASNWriter) errors.Error {
+	err := writer.StartSequence(StreamDescriptionApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.StartSequence(asn1.Context(0))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.WriteInt(int(d.Format))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.EndSequence()
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.StartSequence(asn1.Context(1))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.WriteInt(d.Offset)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.EndSequence()
+	if err != nil {
+		return errors.Update(err)
+	}
+	return writer.EndSequence()
+}
+
+func (d *StreamDescription) Decode(reader *asn1.ASNReader) errors.Error {
+	_, descriptionReader, err := reader.ReadSequenceStart(StreamDescriptionApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	for descriptionReader.Len() > 0 {
+		peek, err := descriptionReader.Peek()
+		if err != nil {
+			return errors.Update(err)
+		}
+		_, ctxtReader, err := descriptionReader.ReadSequenceStart(peek)
+		if err != nil {
+			return errors.Update(err)
+		}
+		switch peek {
+		case asn1.Context(0):
+			format, err := ctxtReader.ReadInt()
+			if err != nil {
+				return errors.Update(err)
+			}
+			d.Format = StreamFormat(format)
+			break
+		case asn1.Context(1):
+			offset, err := ctxtReader.ReadInt()
+			if err != nil {
+				return errors.Update(err)
+			}
+			d.Offset = offset
+			break
+		default:
+			return errors.New("StreamDescription decode error: Unknown tag %d", peek)
+		}
+		err = ctxtReader.ReadSequenceEnd()
+		if err != nil {
+			return errors.Update(err)
+		}
+		end, err := descriptionReader.CheckSequenceEnd()
+		if end || err != nil {
+			break
+		}
+	}
+	return errors.Update(err)
+}
+
+// StreamEntry is the value of a stream sent by the provider.
+type StreamEntry struct {
+	StreamIdentifier int
+	Value            *ContentParameter
+}
+
+func NewStreamEntry(streamIdentifier int, value *ContentParameter) *StreamEntry {
+	return &StreamEntry{StreamIdentifier: streamIdentifier, Value: value}
+}
+
+func (entry *StreamEntry) Encode(writer *asn1.ASNWriter) errors.Error {
+	err := writer.StartSequence(StreamEntryApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.StartSequence(asn1.Context(0))
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.WriteInt(entry.StreamIdentifier)
+	if err != nil {
+		return errors.Update(err)
+	}
+	err = writer.EndSequence()
+	if err != nil {
+		return errors.Update(err)
+	}
+	if entry.Value != nil {
+		err = entry.Value.Encode(1, writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return writer.EndSequence()
+}
+
+func (entry *StreamEntry) Decode(reader *asn1.ASNReader) errors.Error {
+	_, entryReader, err := reader.ReadSequenceStart(StreamEntryApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	for entryReader.Len() > 0 {
+		peek, err := entryReader.Peek()
+		if err != nil {
+			return errors.Update(err)
+		}
+		switch peek {
+		case asn1.Context(0):
+			_, ctxtReader, err := entryReader.ReadSequenceStart(peek)
+			if err != nil {
+				return errors.Update(err)
+			}
+			id, err := ctxtReader.ReadInt()
+			if err != nil {
+				return errors.Update(err)
+			}
+			entry.StreamIdentifier = id
+			err = ctxtReader.ReadSequenceEnd()
+			if err != nil {
+				return errors.Update(err)
+			}
+			break
+		case asn1.Context(1):
+			value, err := DecodeValue(entryReader, 1)
+			if err != nil {
+				return errors.Update(err)
+			}
+			entry.Value = value
+			break
+		default:
+			return errors.New("StreamEntry decode error: Unknown tag %d", peek)
+		}
+		end, err := entryReader.CheckSequenceEnd()
+		if end || err != nil {
+			break
+		}
+	}
+	return errors.Update(err)
+}
+
+func encodeStreamCollection(entries []*StreamEntry, writer *asn1.ASNWriter) errors.Error {
+	err := writer.StartSequence(StreamCollectionApplication)
+	if err != nil {
+		return errors.Update(err)
+	}
+	for _, entry := range entries {
+		err = writer.StartSequence(asn1.Context(0))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = entry.Encode(writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return writer.EndSequence()
+}
+
+func decodeStreamCollection(reader *asn1.ASNReader) ([]*StreamEntry, errors.Error) {
+	entries := []*StreamEntry{}
+	_, collectionReader, err := reader.ReadSequenceStart(StreamCollectionApplication)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	for collectionReader.Len() > 0 {
+		_, entryReader, err := collectionReader.ReadSequenceStart(asn1.Context(0))
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		entry := &StreamEntry{}
+		err = entry.Decode(entryReader)
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		entries = append(entries, entry)
+		err = entryReader.ReadSequenceEnd()
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+		end, err := collectionReader.CheckSequenceEnd()
+		if end {
+			break
+		}
+		if err != nil {
+			return nil, errors.Update(err)
+		}
+	}
+	return entries, nil
+}
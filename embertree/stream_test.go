@@ -0,0 +1,128 @@
+package embertree_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+func TestStreamDescriptionExtract(t *testing.T) {
+	stream := []byte{0xff, 0x01, 0x02, 0x00, 0x00, 0xc0, 0x3f}
+	tests := []struct {
+		descriptor *embertree.StreamDescription
+		integer    int64
+		real       float64
+	}{
+		{embertree.NewStreamDescription(embertree.StreamFormatUInt8, 0), 255, 0},
+		{embertree.NewStreamDescription(embertree.StreamFormatInt8, 0), -1, 0},
+		{embertree.NewStreamDescription(embertree.StreamFormatUInt16BigEndian, 1), 0x0102, 0},
+		{embertree.NewStreamDescription(embertree.StreamFormatUInt16LittleEndian, 1), 0x0201, 0},
+		{embertree.NewStreamDescription(embertree.StreamFormatInt16LittleEndian, 0), 0x01ff, 0},
+		{embertree.NewStreamDescription(embertree.StreamFormatFloat32LittleEndian, 3), 0, 1.5},
+	}
+	for _, test := range tests {
+		value, err := test.descriptor.Extract(stream)
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		if value.GetType() == embertree.ValueTypeReal {
+			r, _ := value.GetReal()
+			if r != test.real {
+				t.Errorf("Format %d: got %f instead of %f", test.descriptor.Format, r, test.real)
+			}
+		} else {
+			i, _ := value.GetInt()
+			if i != test.integer {
+				t.Errorf("Format %d: got %d instead of %d", test.descriptor.Format, i, test.integer)
+			}
+		}
+	}
+	_, err := embertree.NewStreamDescription(embertree.StreamFormatFloat64BigEndian, 0).Extract(stream)
+	if err == nil {
+		t.Errorf("Expected error reading past the stream end")
+	}
+}
+
+type countingListener struct {
+	count int
+}
+
+func (l *countingListener) Receive(node interface{}, err errors.Error) {
+	l.count++
+}
+
+func TestStreamCollectionDecode(t *testing.T) {
+	tree := embertree.NewTree()
+	node := embertree.NewNode(1)
+	node.CreateContent()
+	tree.AddElement(node)
+	left := embertree.NewParameter(1)
+	leftContents := left.CreateContent().(*embertree.ParameterContents)
+	leftContents.SetStreanIdentifier(10)
+	leftContents.SetStreamDescriptor(embertree.NewStreamDescription(embertree.StreamFormatInt16BigEndian, 0))
+	node.AddChild(left)
+	right := embertree.NewParameter(2)
+	rightContents := right.CreateContent().(*embertree.ParameterContents)
+	rightContents.SetStreanIdentifier(10)
+	rightContents.SetStreamDescriptor(embertree.NewStreamDescription(embertree.StreamFormatInt16BigEndian, 2))
+	node.AddChild(right)
+	gain := embertree.NewParameter(3)
+	gainContents := gain.CreateContent().(*embertree.ParameterContents)
+	gainContents.SetStreanIdentifier(11)
+	node.AddChild(gain)
+	listener := &countingListener{}
+	left.AddListener(listener)
+
+	octets := embertree.NewContentParameter()
+	octets.SetBuffer([]byte{0xff, 0xf6, 0x00, 0x05})
+	integer := embertree.NewContentParameter()
+	integer.SetInt(-20)
+	writer := asn1.NewASNWriter()
+	err := embertree.NewStreamRoot([]*embertree.StreamEntry{
+		embertree.NewStreamEntry(10, octets),
+		embertree.NewStreamEntry(11, integer)}).Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	err = tree.Decode(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	expected := map[*embertree.ParameterContents]int64{leftContents: -10, rightContents: 5, gainContents: -20}
+	for contents, value := range expected {
+		i, err := contents.GetValueObject().GetInt()
+		if err != nil || i != value {
+			t.Errorf("Got %d instead of %d", i, value)
+		}
+	}
+	if listener.count != 1 {
+		t.Errorf("Listener called %d times", listener.count)
+	}
+}
+
+func TestParameterStreamDescriptorEncode(t *testing.T) {
+	parameter := embertree.NewParameter(4)
+	contents := parameter.CreateContent().(*embertree.ParameterContents)
+	contents.SetIdentifier("meter")
+	contents.SetStreanIdentifier(3)
+	contents.SetStreamDescriptor(embertree.NewStreamDescription(embertree.StreamFormatFloat32LittleEndian, 8))
+	writer := asn1.NewASNWriter()
+	err := parameter.Encode(writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	b := make([]byte, writer.Len())
+	writer.Read(b)
+	decoded, err := embertree.DecodeElement(asn1.NewASNReader(b))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	descriptor := decoded.GetContent().(*embertree.ParameterContents).GetStreamDescriptor()
+	if descriptor == nil || descriptor.Format != embertree.StreamFormatFloat32LittleEndian || descriptor.Offset != 8 {
+		t.Errorf("Invalid stream descriptor decoded")
+	}
+}
@@ -0,0 +1,207 @@
+package embertree
+
+import (
+	"fmt"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+var TemplateApplication = asn1.Application(24)
+
+// TemplateContents holds the element a template describes and the template
+// description. Unlike other contents, they are not encoded in a set but as the
+// element [1] and description [2] fields of the template.
+type TemplateContents struct {
+	element     *Element
+	description ContentParameter
+}
+
+func NewTemplateContents() EmberContents {
+	return &TemplateContents{}
+}
+
+func NewTemplate(number int) *Element {
+	return NewElement(TemplateApplication, number, NewTemplateContents)
+}
+
+// IsTemplate returns true for templates and qualified templates.
+func (element *Element) IsTemplate() bool {
+	return GetUnqualifiedTag(element.tag) == TemplateApplication
+}
+
+func (contents *TemplateContents) merge(update EmberContents) ([]FieldChange, bool) {
+	u, ok := update.(*TemplateContents)
+	if !ok {
+		return nil, false
+	}
+	changes := contents.description.mergeField("description", &u.description, nil)
+	if u.element != nil {
+		changes = appendChange(changes, "element", contents.element, u.element)
+		contents.element = u.element
+	}
+	return changes, true
+}
+
+// SetElement sets the parameter, node, matrix or function describing the
+// structure shared by the elements referencing the template.
+func (contents *TemplateContents) SetElement(element *Element) {
+	contents.element = element
+}
+
+func (contents *TemplateContents) GetElement() *Element {
+	return contents.element
+}
+
+func (contents *TemplateContents) SetDescription(description string) {
+	contents.description.SetString(description)
+}
+
+func (contents *TemplateContents) GetDescription() (string, errors.Error) {
+	return contents.description.GetString()
+}
+
+func (contents *TemplateContents) Encode(writer *asn1.ASNWriter) errors.Error {
+	if contents.element != nil {
+		err := writer.StartSequence(asn1.Context(1))
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = contents.element.Encode(writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+		err = writer.EndSequence()
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	if contents.description.IsSet() {
+		err := contents.description.Encode(2, writer)
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return nil
+}
+
+// Decode reads the fields following the template number or path.
+func (contents *TemplateContents) Decode(reader *asn1.ASNReader) errors.Error {
+	for reader.Len() > 0 {
+		peek, err := reader.Peek()
+		if err != nil {
+			return errors.Update(err)
+		}
+		switch peek {
+		case asn1.Context(1):
+			_, elementReader, err := reader.ReadSequenceStart(peek)
+			if err != nil {
+				return errors.Update(err)
+			}
+			element, err := DecodeElement(elementReader)
+			if err != nil {
+				return errors.Update(err)
+			}
+			contents.element = element
+			err = elementReader.ReadSequenceEnd()
+			if err != nil {
+				return errors.Update(err)
+			}
+		case asn1.Context(2):
+			value, err := DecodeValue(reader, peek)
+			if err != nil {
+				return errors.Update(err)
+			}
+			contents.description.Set(value)
+		default:
+			return errors.New("Unknown template tag 0x%x at offset %d.", peek, reader.TopOffset())
+		}
+		end, err := reader.CheckSequenceEnd()
+		if end {
+			break
+		}
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return nil
+}
+
+func (contents *TemplateContents) ToString() string {
+	str := ""
+	description, err := contents.GetDescription()
+	if err == nil {
+		str = fmt.Sprintf("%s  description: %s\n", str, description)
+	}
+	if contents.element != nil {
+		str = fmt.Sprintf("%s  element: %d\n", str, contents.element.tag)
+	}
+	return str
+}
+
+// templateReferencer is implemented by the contents that can reference a template.
+type templateReferencer interface {
+	GetTemplateReference() (asn1.RelativeOID, errors.Error)
+}
+
+// describedContents is implemented by the contents holding a description.
+type describedContents interface {
+	GetDescription() (string, errors.Error)
+}
+
+// GetTemplateReference returns the path of the template the element is based on.
+func (element *Element) GetTemplateReference() (asn1.RelativeOID, errors.Error) {
+	contents, ok := element.contents.(templateReferencer)
+	if !ok {
+		return nil, errors.New("Element %s can't reference a template.", Path2String(element.GetPath()))
+	}
+	reference, err := contents.GetTemplateReference()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	if len(reference) == 0 {
+		return nil, errors.New("Element %s has no template reference.", Path2String(element.GetPath()))
+	}
+	return reference, nil
+}
+
+// GetTemplate returns the template referenced by element. The template must
+// have been received.
+func (root *RootElement) GetTemplate(element *Element) (*TemplateContents, errors.Error) {
+	reference, err := element.GetTemplateReference()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	_, template := root.GetElementByPath(reference)
+	if template == nil {
+		return nil, errors.New("Template %s not found.", Path2String(reference))
+	}
+	contents, ok := template.contents.(*TemplateContents)
+	if !ok {
+		return nil, errors.New("Element %s is not a template.", Path2String(reference))
+	}
+	return contents, nil
+}
+
+// GetInheritedDescription returns the description of element or, when it has
+// none, the one of the element described by its template, then the template
+// description.
+func (root *RootElement) GetInheritedDescription(element *Element) (string, errors.Error) {
+	if contents, ok := element.contents.(describedContents); ok {
+		if description, err := contents.GetDescription(); err == nil && description != "" {
+			return description, nil
+		}
+	}
+	template, err := root.GetTemplate(element)
+	if err != nil {
+		return "", errors.Update(err)
+	}
+	if template.element != nil {
+		if contents, ok := template.element.contents.(describedContents); ok {
+			if description, err := contents.GetDescription(); err == nil && description != "" {
+				return description, nil
+			}
+		}
+	}
+	return template.GetDescription()
+}
@@ -0,0 +1,87 @@
+package embertree_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func newTemplateTestMessage() *embertree.RootElement {
+	message := embertree.NewRoot()
+	template := embertree.NewTemplate(1)
+	templateContents := template.CreateContent().(*embertree.TemplateContents)
+	templateContents.SetDescription("Channel template")
+	channel := embertree.NewNode(0)
+	channel.CreateContent().(*embertree.NodeContents).SetDescription("Input channel")
+	gain := embertree.NewParameter(1)
+	gain.CreateContent().(*embertree.ParameterContents).SetIdentifier("gain")
+	channel.AddChild(gain)
+	templateContents.SetElement(channel)
+	message.AddElement(template)
+
+	inputs := embertree.NewNode(2)
+	inputs.CreateContent().(*embertree.NodeContents).SetIdentifier("inputs")
+	input := embertree.NewNode(1)
+	inputContents := input.CreateContent().(*embertree.NodeContents)
+	inputContents.SetIdentifier("input1")
+	inputContents.SetTemplateReference(asn1.RelativeOID{1})
+	inputs.AddChild(input)
+	message.AddElement(inputs)
+	return message
+}
+
+func TestTemplateDecode(t *testing.T) {
+	tree := embertree.NewTree()
+	decodeRoot(t, tree, newTemplateTestMessage())
+
+	_, template := tree.GetElementByPath(asn1.RelativeOID{1})
+	if template == nil || !template.IsTemplate() {
+		t.Fatal("Template not decoded")
+	}
+	_, input := tree.GetElementByPath(asn1.RelativeOID{2, 1})
+	contents, err := tree.GetTemplate(input)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	description, err := contents.GetDescription()
+	if err != nil || description != "Channel template" {
+		t.Errorf("Unexpected template description %s", description)
+	}
+	structure := contents.GetElement()
+	if structure == nil || structure.GetTag() != embertree.NodeApplication {
+		t.Fatal("Template element not decoded")
+	}
+	if gain := structure.GetChildByIdentifier("gain"); gain == nil {
+		t.Error("Template structure not decoded")
+	}
+	description, err = tree.GetInheritedDescription(input)
+	if err != nil || description != "Input channel" {
+		t.Errorf("Unexpected inherited description %s", description)
+	}
+
+	_, inputs := tree.GetElementByPath(asn1.RelativeOID{2})
+	if _, err = tree.GetTemplate(inputs); err == nil {
+		t.Error("Expected an error for an element without template")
+	}
+}
+
+func TestQualifiedTemplateDecode(t *testing.T) {
+	tree := embertree.NewTree()
+	decodeRoot(t, tree, newTemplateTestMessage())
+
+	message := embertree.NewRoot()
+	template := embertree.NewQualifiedTemplate(asn1.RelativeOID{2, 3})
+	template.CreateContent().(*embertree.TemplateContents).SetDescription("Output template")
+	message.AddElement(template)
+	decodeRoot(t, tree, message)
+
+	_, element := tree.GetElementByPath(asn1.RelativeOID{2, 3})
+	if element == nil || !element.IsTemplate() {
+		t.Fatal("Qualified template not decoded")
+	}
+	description, err := element.GetContent().(*embertree.TemplateContents).GetDescription()
+	if err != nil || description != "Output template" {
+		t.Errorf("Unexpected template description %s", description)
+	}
+}
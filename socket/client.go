@@ -1,9 +1,9 @@
 package socket
 
 import (
-	"container/list"
-	"fmt"
-	"net"
+	"io"
+	"sync"
+	"sync/atomic"
 	"time"
 	. "github.com/dufourgilles/emberlib/logger"
 	"github.com/dufourgilles/emberlib/asn1"
@@ -11,351 +11,434 @@ import (
 	"github.com/dufourgilles/emberlib/errors"
 )
 
-const maxQueueSize = 256
 const maxBufferSize = 65536
 
-type packetQueue struct {
-	queue *list.List
-}
-
-type channelMessage interface {
-	getError() error
-	getData() []byte
-}
-
-
-func newPacketQueue() *packetQueue {
-	var q packetQueue
-	q.queue = list.New()
-	return &q
-}
-
-func (p *packetQueue) size() int {
-	return p.queue.Len()
+// timedListener forwards to listener the first of the response and the timeout.
+type timedListener struct {
+	node     embertree.ListeningNode
+	listener embertree.Listener
+	timer    *time.Timer
+	done     int32
 }
 
-func (p *packetQueue) isEmpty() bool {
-	return p.queue.Len() == 0
+func newTimedListener(node embertree.ListeningNode, listener embertree.Listener, timeout time.Duration, timeoutError errors.Error) *timedListener {
+	t := &timedListener{node: node, listener: listener}
+	t.timer = time.AfterFunc(timeout, func() {
+		if atomic.CompareAndSwapInt32(&t.done, 0, 1) {
+			t.node.RemoveListener(t)
+			t.listener.Receive(nil, timeoutError)
+		}
+	})
+	return t
 }
 
-func (p *packetQueue) add(msg *embertree.RootElement) errors.Error{
-	if p.size() > maxQueueSize {
-		return errors.New("Queue size limit. Drop message.")
+func (t *timedListener) Receive(node interface{}, err errors.Error) {
+	if t.cancel() {
+		t.listener.Receive(node, err)
 	}
-	p.queue.PushBack(msg)
-	return nil
 }
 
-func (p *packetQueue) getNext() (*embertree.RootElement, errors.Error) {
-	if p.queue.Len() > 0 {
-		qElement :=  p.queue.Front()
-		p.queue.Remove(qElement)
-		if val, ok := qElement.Value.(*embertree.RootElement); ok {			
-			return val, nil
-		}
-		return nil, errors.New("Queue Error: Queue Datatype is incorrect")
+// cancel stops the timer and returns false if the listener was already called.
+func (t *timedListener) cancel() bool {
+	if !atomic.CompareAndSwapInt32(&t.done, 0, 1) {
+		return false
 	}
-	return nil, nil
-}
-
-type _TimerCallbacks struct {
-	timer *time.Timer
-	listener embertree.Listener
-	client *S101Client
+	t.timer.Stop()
+	t.node.RemoveListener(t)
+	return true
 }
 
+// S101Client is an Ember+ consumer. A reader goroutine decodes the messages from
+// the provider into the tree and calls the listeners. A writer goroutine sends
+// the queued messages. Listeners are called from the reader goroutine and must
+// not block waiting for another response.
 type S101Client struct {
 	stats S101SocketStats
-	conn  net.Conn
-	raddr string
-	outQ  *packetQueue
-	decoder *S101Decoder
+	statsLock sync.Mutex
+	// connLock guards the connection and the client configuration.
+	connLock sync.Mutex
+	conn  *connection
+	transport Transport
 	msTimeout int
-	logger Logger
-	timerCallbacks map[embertree.ListeningNode]*_TimerCallbacks
-	getTreeCallback embertree.Listener
+	framing S101Framing
+	reconnectPolicy *ReconnectPolicy
+	reconnectStop chan struct{}
+	outQ  *packetQueue
+	// treeLock guards the tree against the reader goroutine.
+	treeLock sync.Mutex
 	tree *embertree.RootElement
-	incomingDataChan chan channelMessage
-	outgoingDataChan chan channelMessage
-	freeTimerCallback embertree.Listener
+	// stateLock guards the logger and the expanded paths restored after a
+	// reconnection.
+	stateLock sync.Mutex
+	logger Logger
+	rootExpanded bool
+	expandedPaths map[string]asn1.RelativeOID
+	keepAlive keepAliveState
+	lastInvocationID int32
+	subscriptions subscriptions
 }
 
 func (s *S101Client)keepAliveReqHandler(kal []byte) errors.Error {
 	// This should go at the head of the queue
-	s.logger.Debug("KAL Request Received.\n")
-	s.outQ.queue.PushFront(GetKeepAliveResponse())
-	return nil
+	s.getLogger().Debug("KAL Request Received.\n")
+	return s.outQ.addFrameFront(s.GetFraming().KeepAliveResponse())
 }
 
 func (s *S101Client)keepAliveResponseHandler(kal []byte) errors.Error {
-	// do nothing for the moment
-	s.logger.Debug("KAL Response Received.\n")
+	s.getLogger().Debug("KAL Response Received.\n")
+	s.keepAlive.responseReceived()
 	return nil
 }
 
 func (s *S101Client)emberPacketHandler(packet []byte) errors.Error {
 	// This should be a valid EmberRoot.
-	s.logger.Debug("Ember Frame - start decoding.\n")
-	s.logger.Debugln(packet)
+	s.getLogger().Debug("Ember Frame - start decoding.\n")
+	s.getLogger().Debugln(packet)
+	s.treeLock.Lock()
 	err := s.tree.Decode(asn1.NewASNReader(packet))
-	s.errorHandler(err)
+	s.treeLock.Unlock()
+	if err != nil {
+		s.errorHandler(err)
+	}
 	return err
 }
 
 func (s *S101Client)errorHandler(err errors.Error) {
-	s.logger.Error(err)
+	s.getLogger().Error(err)
 }
 
 func NewS101Client() *S101Client {
 	client := S101Client{msTimeout: 0}
-	client.decoder = NewS101Decoder(client.keepAliveReqHandler,client.keepAliveResponseHandler,client.emberPacketHandler, client.errorHandler )
 	client.stats.Reset()
 	client.logger = NewNullLogger()
-	client.timerCallbacks = make(map[embertree.ListeningNode]*_TimerCallbacks)
 	client.outQ = newPacketQueue()
 	client.tree = embertree.NewTree()
-	client.incomingDataChan = make(chan channelMessage, 100)
-	client.outgoingDataChan = make(chan channelMessage, 1)	
+	client.expandedPaths = make(map[string]asn1.RelativeOID)
+	client.subscriptions.entries = make(map[string]*Subscription)
+	client.subscriptions.pending = make(map[string]*pendingSubscribe)
 	return &client
 }
 
 func (s *S101Client)SetTimeout(msTimeout int) {
 	if msTimeout >= 0 {
+		s.connLock.Lock()
 		s.msTimeout = msTimeout
+		s.connLock.Unlock()
 	}
 }
 
+func (s *S101Client)getTimeout() time.Duration {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return time.Duration(s.msTimeout) * time.Millisecond
+}
+
+// SetLogger sets the logger of the client. It can be changed while connected.
 func (s *S101Client)SetLogger(logger Logger) {
 	if logger != nil {
+		s.stateLock.Lock()
 		s.logger = logger
+		s.stateLock.Unlock()
 	}
 }
 
+func (s *S101Client)getLogger() Logger {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	return s.logger
+}
+
+// GetStats returns a snapshot of the socket statistics.
+func (s *S101Client)GetStats() S101SocketStats {
+	s.statsLock.Lock()
+	stats := s.stats.Snapshot()
+	s.statsLock.Unlock()
+	stats.QueueDrops = s.outQ.getDrops()
+	stats.QueueMerges = s.outQ.getMerged()
+	stats.KeepAliveRTT = s.GetKeepAliveRTT()
+	return stats
+}
+
+// WritePrometheus writes the socket statistics in the Prometheus text exposition
+// format with metric names starting with "emberplus_s101".
+func (s *S101Client)WritePrometheus(w io.Writer) error {
+	stats := s.GetStats()
+	return stats.WritePrometheus(w, "emberplus_s101")
+}
+
+func (s *S101Client)recordRequest(command string, start time.Time, err errors.Error) {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	s.stats.recordRequest(command, time.Since(start), err != nil)
+}
+
+// WithTree calls f with the local tree. The reader goroutine does not update the
+// tree until f returns.
+func (s *S101Client)WithTree(f func(tree *embertree.RootElement)) {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	f(s.tree)
+}
+
 func (s *S101Client)Connect(address string, port uint16) errors.Error {
-	var err error
+	return s.ConnectTransport(NewTCPTransport(address, port))
+}
+
+// ConnectTransport connects to the provider through transport. The transport is
+// opened again on reconnection.
+func (s *S101Client)ConnectTransport(transport Transport) errors.Error {
+	s.stopReconnect()
 	if s.IsConnected() {
-		return errors.New("Client already connected to %s:%d", address, port)
+		return errors.New("Client already connected to %s", transport)
 	}
-	s.raddr = fmt.Sprintf("%s:%d", address, port)
-	s.conn, err = net.Dial("tcp", s.raddr)
+	stream, err := transport.Open()
 	if err != nil {
-		return errors.NewError(err)
+		return errors.Update(err)
 	}
-	go s.iomanager()
+	return s.connectStream(transport, stream)
+}
+
+// ConnectStream runs the client over an already open stream such as a net.Conn
+// or a net.Pipe end. There is no reconnection since the stream can't be reopened.
+func (s *S101Client)ConnectStream(stream io.ReadWriteCloser) errors.Error {
+	s.stopReconnect()
+	return s.connectStream(nil, stream)
+}
+
+func (s *S101Client)connectStream(transport Transport, stream io.ReadWriteCloser) errors.Error {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	if s.conn != nil {
+		stream.Close()
+		return errors.New("Client already connected to %s", s.getAddressLocked())
+	}
+	s.transport = transport
+	s.start(stream)
 	return nil
 }
 
-func (s *S101Client)Disconnect() errors.Error {
-	if !s.IsConnected() {
-		return errors.New("Client not connected.")
+// start makes stream the active connection and launches its reader, writer and
+// keep-alive goroutines. connLock must be held.
+func (s *S101Client)start(stream io.ReadWriteCloser) {
+	conn := &connection{stream: stream, done: make(chan struct{})}
+	s.conn = conn
+	go s.reader(conn)
+	go s.writer(conn)
+	if interval := s.keepAlive.getInterval(); interval > 0 {
+		go s.keepAliveLoop(conn, interval)
+	}
+	// Messages queued while disconnected.
+	s.outQ.notify()
+}
+
+// closeConnection closes conn and returns true if it was the active connection.
+func (s *S101Client)closeConnection(conn *connection) bool {
+	s.connLock.Lock()
+	if conn == nil || s.conn != conn {
+		s.connLock.Unlock()
+		return false
 	}
-	err := s.conn.Close()
 	s.conn = nil
-	return errors.NewError(err)
+	close(conn.done)
+	s.connLock.Unlock()
+	conn.stream.Close()
+	return true
+}
+
+func (s *S101Client)getAddress() string {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return s.getAddressLocked()
+}
+
+func (s *S101Client)getAddressLocked() string {
+	if s.transport == nil {
+		return "stream"
+	}
+	return s.transport.String()
+}
+
+func (s *S101Client)Disconnect() errors.Error {
+	stopped := s.stopReconnect()
+	s.connLock.Lock()
+	conn := s.conn
+	s.connLock.Unlock()
+	if s.closeConnection(conn) || stopped {
+		return nil
+	}
+	return errors.New("Client not connected.")
+}
+
+// SetFraming selects the framing of the messages sent to the provider. Both
+// framings are always accepted from the provider.
+func (s *S101Client)SetFraming(framing S101Framing) {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	s.framing = framing
+}
+
+func (s *S101Client)GetFraming() S101Framing {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	return s.framing
 }
 
 func (s *S101Client)IsConnected() bool {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
 	return s.conn != nil
 }
 
-func (s *S101Client)sendBER(data []byte) errors.Error {
-	if !s.IsConnected() {
-		return errors.New("Not connected")
-	}
-	frames := EncodeMessage(data)
+func sendBERFrames(conn io.Writer, data []byte, framing S101Framing, stats *S101SocketStats) errors.Error {
+	frames := framing.EncodeMessage(data)
 	for i := 0; i < frames.Size(); i++ {
 		message, err := frames.GetBytesAt(i)
 		if err != nil {
-			s.stats.TxErrors++
+			stats.TxErrors++
 			return errors.Update(err)
 		}
 		var res int
-		res, e := s.conn.Write(message)
+		res, e := conn.Write(message)
 		if e != nil {
-			s.stats.TxErrors++
+			stats.TxErrors++
 			return errors.NewError(e)
 		}
-		s.stats.TxPackets++
-		s.stats.TxBytes += uint64(res)
+		stats.TxPackets++
+		stats.TxBytes += uint64(res)
 	}
 	return nil
 }
 
-func (s *S101Client)sendBERNode(node *embertree.RootElement) errors.Error {
-	if node == nil {
-		return errors.New("null node")
+func encodeRoot(root *embertree.RootElement) ([]byte, errors.Error) {
+	if root == nil {
+		return nil, errors.New("null node")
 	}
 	writer := asn1.ASNWriter{}
-	err := node.Encode(&writer)
+	err := root.Encode(&writer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	data := make([]byte, writer.Len())
 	writer.Read(data)
-	return s.sendBER(data)
+	return data, nil
 }
 
-
-func (t *_TimerCallbacks)Receive(node interface{}, err errors.Error) {
-	treeNode := node.(embertree.ListeningNode)
-	timerCB := t.client.timerCallbacks[treeNode]
-	if timerCB == nil {
-		return
+func (s *S101Client)sendFrame(conn *connection, frame []byte) errors.Error {
+	res, err := conn.stream.Write(frame)
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+	if err != nil {
+		s.stats.TxErrors++
+		return errors.NewError(err)
 	}
-	t.client.logger.Debug("Timer Stopped.\n")
-	timerCB.timer.Stop()
-	delete(t.client.timerCallbacks, treeNode)
-	// Remove myself from node
-	treeNode.RemoveListener(t)
+	s.stats.TxPackets++
+	s.stats.TxBytes += uint64(res)
+	return nil
 }
 
-func (s *S101Client)runTimer(node *embertree.Element, callback embertree.Listener, timeoutError errors.Error) {
-	var treeNode embertree.ListeningNode
-	if node == nil {
-		treeNode = s.tree
-	} else {
-		treeNode = node
+func (s *S101Client)send(conn *connection, msg *queuedMessage) errors.Error {
+	if msg.framed {
+		return s.sendFrame(conn, msg.data)
+	}
+	frames := s.GetFraming().EncodeMessage(msg.data)
+	for i := 0; i < frames.Size(); i++ {
+		frame, err := frames.GetBytesAt(i)
+		if err == nil {
+			err = s.sendFrame(conn, frame)
+		}
+		if err != nil {
+			return errors.Update(err)
+		}
 	}
-	s.logger.Debug("Timer running.\n")
-	freeTimerCallback := &_TimerCallbacks{client: s, timer: time.NewTimer(time.Duration(int64(s.msTimeout)) * time.Millisecond)}
-	treeNode.AddListener(freeTimerCallback)
-	s.timerCallbacks[treeNode] = freeTimerCallback
-	<-s.timerCallbacks[treeNode].timer.C
-	s.logger.Debug("Timer Kicked.\n")
-	callback.Receive(nil, timeoutError)
-	s.logger.Debug("Cleaning Timer callback.\n")
-	delete(s.timerCallbacks, treeNode)
-	treeNode.RemoveListener(s.freeTimerCallback)
+	return nil
 }
 
 func (s *S101Client)GetDirectory(node *embertree.Element, callback embertree.Listener) errors.Error {
 	var msg *embertree.RootElement
 	var err errors.Error
-	timeoutError := errors.New("GetDirectory timed out.")	
+	var treeNode embertree.ListeningNode = s.tree
+	if node != nil {
+		treeNode = node
+	}
+	var timer *timedListener
+	if timeout := s.getTimeout(); timeout > 0 && callback != nil {
+		timer = newTimedListener(treeNode, callback, timeout, errors.New("GetDirectory timed out."))
+		callback = timer
+	}
 	if node == nil {
-		s.logger.Debug("Send GetDirectory for root.\n")
-		msg,err = s.tree.GetDirectoryMsg(callback)		
+		s.getLogger().Debug("Send GetDirectory for root.\n")
+		msg,err = s.tree.GetDirectoryMsg(callback)
+		s.markExpanded(nil)
 	} else {
-		s.logger.Debug("Send GetDirectory for %s.\n", embertree.Path2String(node.GetPath()))
+		s.getLogger().Debug("Send GetDirectory for %s.\n", embertree.Path2String(node.GetPath()))
 		msg = node.GetQualifiedDirectoryMsg(callback)
+		s.markExpanded(node.GetPath())
 	}
-	if err != nil {
-		s.logger.Debug("GetDirectory.\n",err)
-		return errors.Update(err)
-	}
-	if s.msTimeout > 0 {
-		go s.runTimer(node, callback, timeoutError)
-	}
-	
-	return s.outQ.add(msg)
-}
-
-type _ElementListeners struct {
-	client *S101Client
-	rootListener *_RoottListeners
-}
-
-// getElementCallback
-func (l *_ElementListeners)Receive(node interface{}, err errors.Error) {
-	l.client.logger.Debug("Element Callback.\n")	
-	if err == nil && node != nil {
-		element := node.(*embertree.Element)
-		element.RemoveListener(l)
-		for _,child := range(element.Children) {
-			l.rootListener.IncPendingGetDir()
-			elementCallback := &_ElementListeners{client: l.client, rootListener: l.rootListener}
-			go l.client.GetDirectory(child, elementCallback)
+	if err == nil {
+		var path asn1.RelativeOID
+		if node != nil {
+			path = node.GetPath()
 		}
+		err = s.queue(msg, priorityBulk, directoryKey(path))
 	}
-	l.rootListener.DecPendingGetDir(node,err)
-}
-
-type _RoottListeners struct {
-	client *S101Client
-	pendingGetDirectory uint
-	listener embertree.Listener
-}
-
-func (r *_RoottListeners)IncPendingGetDir() {
-	r.pendingGetDirectory++
-}
-
-func (r *_RoottListeners)DecPendingGetDir(node interface{}, err errors.Error) {
-	r.pendingGetDirectory--
-	if r.pendingGetDirectory == 0 {
-		r.listener.Receive(r.client.tree, err)
-	}
-}
-
-func (r *_RoottListeners)Receive(node interface{}, err errors.Error) {	
-	if err == nil && node != nil {
-		root := node.(*embertree.RootElement)
-		r.client.logger.Debug("Root CallBack.\n")
-		r.client.logger.Debug(root.ToString())
-		root.RemoveListener(r)
-		for _,element := range(root.RootElementCollection) {
-			r.IncPendingGetDir()
-			elementCallback := &_ElementListeners{client: r.client, rootListener: r}
-			r.client.logger.Debug("Root Callback GetDir for %s.\n", embertree.Path2String(element.GetPath()))
-			go r.client.GetDirectory(element, elementCallback)
+	if err != nil {
+		s.getLogger().Debug("GetDirectory.\n",err)
+		if timer != nil {
+			timer.cancel()
+		} else if callback != nil {
+			treeNode.RemoveListener(callback)
 		}
+		return errors.Update(err)
 	}
-	if r.pendingGetDirectory == 0 {
-		r.listener.Receive(r.client.tree, err)
-		return
-	}
-}
-
-func (s *S101Client)GetTree(listener embertree.Listener) errors.Error {
-	rootCallback := &_RoottListeners{client: s, listener: listener, pendingGetDirectory: 0}
-	return s.GetDirectory(nil, rootCallback)
-}
-
-func (s *S101Client)processBuffer(l int, buffer []byte) {
-	//Decode the message
-	s.decoder.DecodeBuffer(l, buffer)
+	return nil
 }
 
-func (s *S101Client)iomanager() {
-	s.logger.Debug("iomanager started.\n")
-	buffer := make([]byte, maxBufferSize)
-	for s.IsConnected() {
-		// Send messages present in our Q - but no more than max
-		messagesToSend := s.outQ.queue.Len()
-		if messagesToSend > 3 {
-			messagesToSend = 3;
-		}
-		if messagesToSend > 1 {
-			s.logger.Debug("iomanager to send %d messages.\n", messagesToSend)
+// reader decodes the data received on conn until the connection is closed.
+func (s *S101Client)reader(conn *connection) {
+	s.getLogger().Debug("reader started.\n")
+	decoder := NewS101Decoder(s.keepAliveReqHandler, s.keepAliveResponseHandler, s.emberPacketHandler, s.errorHandler)
+	decoder.SetStats(&s.stats, &s.statsLock)
+	stream := &countingReader{reader: conn.stream, update: func(n int) {
+		s.getLogger().Debug("reader received a message of %d bytes.\n", n)
+		s.statsLock.Lock()
+		s.stats.RxBytes += uint64(n)
+		s.stats.RxPackets++
+		s.statsLock.Unlock()
+	}}
+	_, err := decoder.ReadFrom(stream)
+	if err == nil {
+		err = io.EOF
+	}
+	s.connectionLost(conn, err)
+	s.getLogger().Debug("reader stopped.\n")
+}
+
+// writer sends the queued messages on conn until it is closed.
+func (s *S101Client)writer(conn *connection) {
+	s.getLogger().Debug("writer started.\n")
+	defer s.getLogger().Debug("writer stopped.\n")
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-s.outQ.ready:
 		}
-		count := 0
-		for ; count < messagesToSend; count++ {
-			root,_ := s.outQ.getNext()
-			if root != nil {
-				err := s.sendBERNode(root)
-				if err != nil {
-					s.logger.Error(err)
-				}
-			} else {
-				s.logger.Warn("iomanager invalid nil root to send.\n")
+		for msg := s.outQ.getNext(); msg != nil; msg = s.outQ.getNext() {
+			err := s.send(conn, msg)
+			if err != nil {
+				s.getLogger().Error(err)
+				s.connectionLost(conn, err.Message)
+				return
 			}
 		}
+	}
+}
 
-		// collect inbound messages during next 100ms
-		deadline := time.Now().Add(100)
-		s.conn.SetReadDeadline(deadline)
-		for {
-			len,_ := s.conn.Read(buffer)
-			if len > 0 {
-				s.logger.Debug("iomanager received a message of %d bytes.\n", len)
-				s.stats.RxBytes += uint64(len)
-				s.stats.RxPackets++
-				//process the buffer
-				s.processBuffer(len, buffer)
-			} else {
-				break
-			}
-		}
+func (s *S101Client)connectionLost(conn *connection, err error) {
+	if !s.closeConnection(conn) {
+		// Disconnected by the user or already lost.
+		return
 	}
-	s.logger.Debug("iomanager stopped.\n")
+	s.getLogger().Warn("Connection to %s lost. %s\n", s.getAddress(), err)
+	s.startReconnect()
 }
@@ -1,9 +1,13 @@
 package socket_test
 
 import (
+	"context"
 	"fmt"
+	"sync"
 	"testing"
-	
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
 	"github.com/dufourgilles/emberlib/embertree"
 	"github.com/dufourgilles/emberlib/errors"
 	"github.com/dufourgilles/emberlib/socket"
@@ -49,4 +53,74 @@ func TestClient(t *testing.T) {
 		t.Error(err.Message)
 	}
 	t.Errorf("done.")
-}
\ No newline at end of file
+}
+
+// runConcurrentRequests sends GetDirectory and SetValue requests from several
+// goroutines and returns the number of failed requests.
+func runConcurrentRequests(client *socket.S101Client, count int) int {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	failed := 0
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			var err errors.Error
+			switch i % 3 {
+			case 0:
+				_, err = client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 2})
+			case 1:
+				_, err = client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, i)
+			case 2:
+				_, err = client.GetRootDirectoryContext(ctx)
+			}
+			client.WithTree(func(tree *embertree.RootElement) {
+				tree.GetElementByPath(asn1.RelativeOID{1, 1})
+			})
+			if err != nil {
+				lock.Lock()
+				failed++
+				lock.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	return failed
+}
+
+func TestClientConcurrentRequests(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := connectTestClient(t, port)
+	client.SetTimeout(500)
+	// The logger can be changed while the client goroutines use it.
+	go func() {
+		for i := 0; i < 10; i++ {
+			client.SetLogger(logger.NewNullLogger())
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	failed := runConcurrentRequests(client, 30)
+	if failed > 0 {
+		t.Errorf("%d requests failed", failed)
+	}
+	done := make(chan int)
+	go func() {
+		done <- runConcurrentRequests(client, 30)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	err := client.Disconnect()
+	if err != nil {
+		t.Error(err.Message)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Requests blocked after Disconnect")
+	}
+	if client.IsConnected() {
+		t.Errorf("Client still connected")
+	}
+}
@@ -3,7 +3,9 @@ package socket
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
 
 	. "github.com/dufourgilles/emberlib/logger"
 
@@ -64,6 +66,22 @@ var CRC_TABLE = []uint16{ 0x0000, 0x1189, 0x2312, 0x329b, 0x4624, 0x57ad, 0x6536
     0xf78f, 0xe606, 0xd49d, 0xc514, 0xb1ab, 0xa022, 0x92b9, 0x8330,
     0x7bc7, 0x6a4e, 0x58d5, 0x495c, 0x3de3, 0x2c6a, 0x1ef1, 0x0f78}
 
+// maxNonEscapingFrameSize is the largest non-escaping frame accepted by the decoder.
+const maxNonEscapingFrameSize = 16 * 1024 * 1024
+
+// S101Framing selects how S101 frames are delimited on the wire.
+type S101Framing int32
+
+const (
+	// EscapingFraming delimits frames with S101_BOF/S101_EOF, escapes the bytes
+	// above S101_INV and ends each frame with a CRC.
+	EscapingFraming S101Framing = iota
+	// NonEscapingFraming starts each frame with S101_INV, the number of length
+	// bytes and the big endian frame length. The frame is neither escaped nor
+	// followed by a CRC.
+	NonEscapingFraming
+)
+
 type S101CodecEvent string
 const (
 	KEEP_ALIVE_REQUEST S101CodecEvent = "keepAliveReq"
@@ -119,6 +137,64 @@ func GetKeepAliveResponse() *bytes.Buffer {
 	return finalizeBuffer(packet);
 }
 
+// KeepAliveRequest returns a keep-alive request frame.
+func (f S101Framing) KeepAliveRequest() []byte {
+	if f == NonEscapingFraming {
+		return makeNonEscapingFrame([]byte{SLOT, MSG_EMBER, CMD_KEEPALIVE_REQ, VERSION}).Bytes()
+	}
+	return GetKeepaliveRequest().Bytes()
+}
+
+// KeepAliveResponse returns a keep-alive response frame.
+func (f S101Framing) KeepAliveResponse() []byte {
+	if f == NonEscapingFraming {
+		return makeNonEscapingFrame([]byte{SLOT, MSG_EMBER, CMD_KEEPALIVE_RESP, VERSION}).Bytes()
+	}
+	return GetKeepAliveResponse().Bytes()
+}
+
+// EncodeMessage encodes data into frames. A non-escaping message is never split.
+func (f S101Framing) EncodeMessage(data []byte) *S101FrameList {
+	if f == NonEscapingFraming {
+		return EncodeMessageNonEscaping(data)
+	}
+	return EncodeMessage(data)
+}
+
+func (f S101Framing) String() string {
+	if f == NonEscapingFraming {
+		return "non-escaping"
+	}
+	return "escaping"
+}
+
+// makeNonEscapingFrame prefixes message with S101_INV, the number of length bytes
+// and its length.
+func makeNonEscapingFrame(message []byte) *bytes.Buffer {
+	var frame bytes.Buffer
+	length := len(message)
+	count := 1
+	for l := length >> 8; l > 0; l >>= 8 {
+		count++
+	}
+	frame.WriteByte(S101_INV)
+	frame.WriteByte(uint8(count))
+	for i := count - 1; i >= 0; i-- {
+		frame.WriteByte(uint8(length >> (8 * uint(i))))
+	}
+	frame.Write(message)
+	return &frame
+}
+
+// EncodeMessageNonEscaping encodes data into a single non-escaping frame.
+func EncodeMessageNonEscaping(data []byte) *S101FrameList {
+	message := []byte{SLOT, MSG_EMBER, CMD_EMBER, VERSION, FLAG_SINGLE_PACKET, DTD_GLOW, 2, DTD_VERSION_MINOR, DTD_VERSION_MAJOR}
+	message = append(message, data...)
+	frameList := NewS101FrameList(1)
+	frameList.addFrame(makeNonEscapingFrame(message))
+	return frameList
+}
+
 func makeBERFrame(flags uint8, data []byte) *bytes.Buffer {
 	var frame bytes.Buffer
 	frame.WriteByte(S101_BOF);
@@ -282,6 +358,18 @@ type ErrorHandler func(errors.Error)
 
 type S101Decoder struct {
 	escaped bool
+	// nonEscaping is set while reading a non-escaping frame. lengthBytes is the
+	// number of length bytes still expected (-1 before the count byte) and
+	// remaining the number of frame bytes still expected.
+	nonEscaping bool
+	lengthBytes int
+	remaining int
+	framing int32
+	// reassembling is set between the first and the last frame of a
+	// multi-packet message.
+	reassembling bool
+	stats *S101SocketStats
+	statsLock sync.Locker
 	inbuf bytes.Buffer
 	logger Logger
 	emberbuf bytes.Buffer
@@ -303,6 +391,8 @@ func NewS101Decoder(
 	s101Decoder.emberPacketHandler = emberPacketHandler
 	s101Decoder.errorHandler = errorHandler
 	s101Decoder.logger = NewNullLogger()
+	s101Decoder.stats = &S101SocketStats{}
+	s101Decoder.statsLock = &sync.Mutex{}
 	return &s101Decoder
 }
 
@@ -312,17 +402,86 @@ func (decoder *S101Decoder)SetLogger(logger Logger) {
 	}
 }
 
+// SetStats makes the decoder count the frame errors and reassemblies into stats.
+// lock guards stats.
+func (decoder *S101Decoder)SetStats(stats *S101SocketStats, lock sync.Locker) {
+	decoder.stats = stats
+	decoder.statsLock = lock
+}
+
+// GetStats returns a copy of the statistics updated by the decoder.
+func (decoder *S101Decoder)GetStats() S101SocketStats {
+	decoder.statsLock.Lock()
+	defer decoder.statsLock.Unlock()
+	return decoder.stats.Snapshot()
+}
+
+func (decoder *S101Decoder)count(update func(stats *S101SocketStats)) {
+	decoder.statsLock.Lock()
+	update(decoder.stats)
+	decoder.statsLock.Unlock()
+}
+
+func countDropped(stats *S101SocketStats) { stats.DroppedFrames++ }
+func countInvalid(stats *S101SocketStats) { stats.InvalidFrames++ }
+
+// invalidFrame counts an invalid frame and returns the error describing it.
+func (decoder *S101Decoder)invalidFrame(format string, args ...interface{}) errors.Error {
+	decoder.count(countInvalid)
+	return errors.New(format, args...)
+}
+
+// ReadFrom decodes the data read from reader until it returns an error. It
+// implements io.ReaderFrom and returns a nil error at the end of the stream.
+func (decoder *S101Decoder)ReadFrom(reader io.Reader) (int64, error) {
+	var total int64
+	buffer := make([]byte, maxBufferSize)
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			total += int64(n)
+			decoder.DecodeBuffer(n, buffer)
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// GetFraming returns the framing of the last frame received. It can be called
+// from any goroutine.
+func (decoder *S101Decoder)GetFraming() S101Framing {
+	return S101Framing(atomic.LoadInt32(&decoder.framing))
+}
+
 func (decoder *S101Decoder)DecodeBuffer( bufLen int, buf []byte) {
 	for i := 0; i < bufLen; i++ {
 		b := buf[i];
-		if (decoder.escaped) {
+		if decoder.nonEscaping {
+			decoder.decodeNonEscaping(b)
+		} else if (decoder.escaped) {
 			decoder.inbuf.WriteByte(b ^ S101_XOR);
 			decoder.escaped = false;
 		} else if b == S101_CE {
 			decoder.escaped = true;
 		} else if b == S101_BOF {
+			if decoder.inbuf.Len() > 0 {
+				decoder.count(countDropped)
+			}
 			decoder.inbuf.Reset();
 			decoder.escaped = false;
+		} else if b == S101_INV {
+			// Bytes above S101_INV are always escaped in escaping frames.
+			if decoder.inbuf.Len() > 0 {
+				decoder.count(countDropped)
+			}
+			decoder.inbuf.Reset()
+			decoder.nonEscaping = true
+			decoder.lengthBytes = -1
+			decoder.remaining = 0
 		} else if b == S101_EOF {
 			decoder.logger.Debug("End of Frame - frame size %d.\n", decoder.inbuf.Len())
 			decoder.logger.Debugln(decoder.inbuf)
@@ -339,19 +498,67 @@ func (decoder *S101Decoder)DecodeBuffer( bufLen int, buf []byte) {
 	}
 }
 
+func (decoder *S101Decoder)decodeNonEscaping(b byte) {
+	if decoder.lengthBytes < 0 {
+		if b == 0 || b > 4 {
+			decoder.nonEscaping = false
+			decoder.errorHandler(decoder.invalidFrame("dropping non-escaping frame with %d length bytes.", b))
+			return
+		}
+		decoder.lengthBytes = int(b)
+		return
+	}
+	if decoder.lengthBytes > 0 {
+		decoder.remaining = decoder.remaining << 8 | int(b)
+		decoder.lengthBytes--
+		if decoder.lengthBytes > 0 {
+			return
+		}
+		if decoder.remaining > maxNonEscapingFrameSize {
+			decoder.nonEscaping = false
+			decoder.errorHandler(decoder.invalidFrame("dropping non-escaping frame of %d bytes.", decoder.remaining))
+		} else if decoder.remaining == 0 {
+			decoder.nonEscaping = false
+		}
+		return
+	}
+	decoder.inbuf.WriteByte(b)
+	decoder.remaining--
+	if decoder.remaining > 0 {
+		return
+	}
+	decoder.nonEscaping = false
+	decoder.logger.Debug("End of non-escaping Frame - frame size %d.\n", decoder.inbuf.Len())
+	buffer := make([]byte, decoder.inbuf.Len())
+	decoder.inbuf.Read(buffer)
+	decoder.inbuf.Reset()
+	atomic.StoreInt32(&decoder.framing, int32(NonEscapingFraming))
+	err := decoder.handleMessage(buffer)
+	if err != nil {
+		decoder.errorHandler(err)
+	}
+}
+
 func (decoder *S101Decoder)HandleFrame(buffer []byte) errors.Error {
 	decoder.logger.Debug("Frame parsing. total length %d.\n", len(buffer))
 	if !ValidateFrame(bytes.NewReader(buffer)) {
+		decoder.count(func(stats *S101SocketStats) { stats.CRCErrors++ })
 		return errors.New("dropping frame with invalid CRC")
 	}
+	atomic.StoreInt32(&decoder.framing, int32(EscapingFraming))
+	// remove CRC - 2 bytes
+	return decoder.handleMessage(buffer[:len(buffer) - 2])
+}
+
+// handleMessage dispatches a frame once its framing has been removed.
+func (decoder *S101Decoder)handleMessage(buffer []byte) errors.Error {
 	var (
 		slot byte
 		message byte
 		command byte
 		err error
 	)
-	// remove CRC - 2 bytes
-	frame := bytes.NewReader(buffer[:len(buffer) - 2])
+	frame := bytes.NewReader(buffer)
 	slot,err = frame.ReadByte()
 	if err != nil {
 		return errors.NewError(err)
@@ -361,7 +568,7 @@ func (decoder *S101Decoder)HandleFrame(buffer []byte) errors.Error {
 		return errors.NewError(err)
 	}
 	if (slot != SLOT || message != MSG_EMBER) {
-		return errors.New(fmt.Sprintf("dropping frame (not an ember frame; slot=%d, msg=%d).", slot, message))
+		return decoder.invalidFrame("dropping frame (not an ember frame; slot=%d, msg=%d).", slot, message)
 	}
 	command,err = frame.ReadByte()
 	if err != nil {
@@ -374,7 +581,7 @@ func (decoder *S101Decoder)HandleFrame(buffer []byte) errors.Error {
 	} else if command == CMD_EMBER {
 		return decoder.HandleEmberFrame(frame);
 	} else {		
-		return errors.New(fmt.Sprintf("Unknown command type %d.", command))
+		return decoder.invalidFrame("Unknown command type %d.", command)
 	}
 }
 
@@ -382,31 +589,48 @@ func (decoder *S101Decoder)HandleEmberFrame(frame *bytes.Reader) errors.Error {
 	decoder.logger.Debug("Ember Frame parsing. Total size %d.\n", frame.Len())
 	var emberFrame EmberFrame
 	err := emberFrame.Header.Read(frame)
-	if err != nil { return errors.NewError(err) }
+	if err != nil {
+		decoder.count(countInvalid)
+		return errors.NewError(err)
+	}
 	
 	if emberFrame.Header.Version != VERSION {
 		// ok to accept different version
 	}
 
 	if emberFrame.Header.Dtd != DTD_GLOW {
-		return errors.New(fmt.Sprintf("Dropping frame with non-Glow DTD %d.", emberFrame.Header.Dtd))
+		return decoder.invalidFrame("Dropping frame with non-Glow DTD %d.", emberFrame.Header.Dtd)
 	}
 
 	if emberFrame.Header.AppByteLen != 2 {
-		return errors.New("Frame with unknown DTD length.")
+		return decoder.invalidFrame("Frame with unknown DTD length.")
 	}
 
-	if emberFrame.Header.Flags & FLAG_FIRST_MULTI_PACKET != 0 {
+	first := emberFrame.Header.Flags & FLAG_FIRST_MULTI_PACKET != 0
+	last := emberFrame.Header.Flags & FLAG_LAST_MULTI_PACKET != 0
+	if first {
 		decoder.logger.Debug("Ember Frame first multi packet.\n")
+		if decoder.reassembling {
+			// The previous message never received its last packet.
+			decoder.count(countDropped)
+		}
 		decoder.emberbuf.Reset()
+		decoder.reassembling = !last
+	} else if !decoder.reassembling {
+		decoder.count(countDropped)
+		return errors.New("Dropping multi packet frame received without the first packet.")
 	}
 
 	if emberFrame.Header.Flags & FLAG_EMPTY_PACKET == 0 {
 		decoder.logger.Debug("Ember Frame NOT empty packet. Size %d to %d.\n", frame.Len(), decoder.emberbuf.Len())
 		frame.WriteTo(&decoder.emberbuf)
 	}
-	if emberFrame.Header.Flags & FLAG_LAST_MULTI_PACKET != 0 {
+	if last {
 		decoder.logger.Debug("Ember Frame last packet. Total message size %d.\n", decoder.emberbuf.Len())
+		if !first {
+			decoder.reassembling = false
+			decoder.count(func(stats *S101SocketStats) { stats.Reassemblies++ })
+		}
 		emberPacket := make([]byte, decoder.emberbuf.Len())
 		decoder.emberbuf.Read(emberPacket)
 		decoder.emberbuf.Reset()
@@ -3,6 +3,8 @@ package socket_test
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"net"
 	"testing"
 
 	"github.com/dufourgilles/emberlib/errors"
@@ -90,3 +92,118 @@ func TestDecoder(t *testing.T) {
 		return
 	}
 }
+
+func TestEncodeMessageNonEscaping(t *testing.T) {
+	frameList := socket.NonEscapingFraming.EncodeMessage([]byte{1, 2, 0xFF, 4})
+	if frameList.Size() != 1 {
+		t.Fatalf("Received invalid number of frames. %d received.  1 expected", frameList.Size())
+	}
+	frame, err := frameList.GetBytesAt(0)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	expectedResponse := []byte{0xF8, 1, 13, 0, 14, 0, 1, 192, 1, 2, 31, 2, 1, 2, 0xFF, 4}
+	if !bytes.Equal(frame, expectedResponse) {
+		t.Errorf("Encoded Buffer mismatch %v", frame)
+	}
+	keepAlive := socket.NonEscapingFraming.KeepAliveRequest()
+	if !bytes.Equal(keepAlive, []byte{0xF8, 1, 4, 0, 14, 1, 1}) {
+		t.Errorf("Keep-alive mismatch %v", keepAlive)
+	}
+}
+
+func TestDecoderNonEscaping(t *testing.T) {
+	var packets [][]byte
+	keepAlives := 0
+	var decodeErr errors.Error
+	decoder := socket.NewS101Decoder(
+		func(packet []byte) errors.Error { keepAlives++; return nil },
+		func(packet []byte) errors.Error { return nil },
+		func(packet []byte) errors.Error { packets = append(packets, packet); return nil },
+		func(err errors.Error) { decodeErr = err })
+	large := make([]byte, 3000)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	var stream []byte
+	stream = append(stream, socket.NonEscapingFraming.KeepAliveRequest()...)
+	frame, _ := socket.NonEscapingFraming.EncodeMessage([]byte{0xFE, 0xFF, 0xF8, 0xFD}).GetBytesAt(0)
+	stream = append(stream, frame...)
+	frame, _ = socket.EncodeMessage([]byte{1, 2, 3, 4}).GetBytesAt(0)
+	stream = append(stream, frame...)
+	frame, _ = socket.NonEscapingFraming.EncodeMessage(large).GetBytesAt(0)
+	stream = append(stream, frame...)
+	// Feed the stream a few bytes at a time to cross the frame boundaries.
+	for i := 0; i < len(stream); i += 7 {
+		end := i + 7
+		if end > len(stream) {
+			end = len(stream)
+		}
+		decoder.DecodeBuffer(end-i, stream[i:end])
+	}
+	if decodeErr != nil {
+		t.Fatal(decodeErr.Message)
+	}
+	if keepAlives != 1 {
+		t.Errorf("Expected 1 keep-alive request, got %d", keepAlives)
+	}
+	if len(packets) != 3 {
+		t.Fatalf("Expected 3 packets, got %d", len(packets))
+	}
+	if !bytes.Equal(packets[0], []byte{0xFE, 0xFF, 0xF8, 0xFD}) || !bytes.Equal(packets[1], []byte{1, 2, 3, 4}) || !bytes.Equal(packets[2], large) {
+		t.Errorf("Decoded packets mismatch")
+	}
+	if decoder.GetFraming() != socket.NonEscapingFraming {
+		t.Errorf("Expected non-escaping framing, got %s", decoder.GetFraming())
+	}
+}
+
+func TestDecoderNonEscapingInvalidLength(t *testing.T) {
+	var decodeErr errors.Error
+	var packet []byte
+	decoder := socket.NewS101Decoder(nil, nil,
+		func(p []byte) errors.Error { packet = p; return nil },
+		func(err errors.Error) { decodeErr = err })
+	stream := []byte{0xF8, 9}
+	frame, _ := socket.EncodeMessage([]byte{1, 2, 3, 4}).GetBytesAt(0)
+	stream = append(stream, frame...)
+	decoder.DecodeBuffer(len(stream), stream)
+	if decodeErr == nil {
+		t.Error("Expected an error for an invalid length")
+	}
+	if !bytes.Equal(packet, []byte{1, 2, 3, 4}) {
+		t.Errorf("Failed to resynchronize on the next frame")
+	}
+}
+
+func TestNonEscapingClientServer(t *testing.T) {
+	server := socket.NewS101Server(newTestProviderTree())
+	consumerEnd, providerEnd := net.Pipe()
+	server.ServeStream(providerEnd)
+	defer server.Close()
+	client := socket.NewS101Client()
+	client.SetFraming(socket.NonEscapingFraming)
+	err := client.ConnectStream(&nonEscapingChecker{ReadWriteCloser: consumerEnd})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	checkGetDirectory(t, client)
+}
+
+// nonEscapingChecker fails the first read if the provider does not use the non-escaping framing.
+type nonEscapingChecker struct {
+	io.ReadWriteCloser
+	started bool
+}
+
+func (r *nonEscapingChecker) Read(b []byte) (int, error) {
+	n, err := r.ReadWriteCloser.Read(b)
+	if n > 0 && !r.started {
+		r.started = true
+		if b[0] != socket.S101_INV {
+			return 0, fmt.Errorf("provider did not answer with the non-escaping framing")
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,243 @@
+package socket
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// GetTreeOptions limits the part of the provider tree expanded by GetTree.
+//
+// Include and Exclude hold path patterns like "1.2.*" or "1.3.**". "*" matches
+// one number and "**" any number of them, including none. An element is only
+// expanded when some of its descendants can match an Include pattern (all of
+// them when Include is empty) and it does not match an Exclude pattern.
+type GetTreeOptions struct {
+	// MaxDepth is the depth of the deepest elements received. The root children
+	// are at depth 1. 0 means no limit.
+	MaxDepth int
+	Include  []string
+	Exclude  []string
+	// MaxConcurrent caps the GetDirectory requests waiting for an answer. 0 means
+	// no limit.
+	MaxConcurrent int
+	// Progress is called every time a directory is received. The calls never run
+	// concurrently. They mostly come from the client reader goroutine while the
+	// tree is locked, so Progress must not block nor call the client methods
+	// locking the tree, like WithTree or the blocking requests.
+	Progress func(progress GetTreeProgress)
+}
+
+// GetTreeProgress is reported by GetTree while the tree is expanded.
+type GetTreeProgress struct {
+	// Discovered is the number of elements received.
+	Discovered int
+	// Outstanding is the number of GetDirectory requests sent and not answered.
+	Outstanding int
+	// Waiting is the number of elements still to be expanded.
+	Waiting int
+}
+
+// treeWalker expands the provider tree breadth first.
+type treeWalker struct {
+	client   *S101Client
+	options  GetTreeOptions
+	include  [][]string
+	exclude  [][]string
+	listener embertree.Listener
+	lock     sync.Mutex
+	// progressLock serialises the Progress calls.
+	progressLock sync.Mutex
+	waiting      []*embertree.Element
+	inFlight     int
+	discovered   int
+	err          errors.Error
+}
+
+// directoryListener forwards the response of a GetDirectory to the walker.
+type directoryListener struct {
+	walker  *treeWalker
+	element *embertree.Element
+}
+
+func (l *directoryListener) Receive(node interface{}, err errors.Error) {
+	var children map[int]*embertree.Element
+	if err == nil && node != nil {
+		if l.element == nil {
+			l.walker.client.tree.RemoveListener(l)
+			children = node.(*embertree.RootElement).RootElementCollection
+		} else {
+			l.element.RemoveListener(l)
+			children = node.(*embertree.Element).Children
+		}
+	}
+	l.walker.received(children, err)
+}
+
+func splitPatterns(patterns []string) [][]string {
+	split := make([][]string, len(patterns))
+	for i, pattern := range patterns {
+		split[i] = strings.Split(pattern, ".")
+	}
+	return split
+}
+
+// matchPattern reports whether path matches pattern and whether a descendant
+// of path could match it.
+func matchPattern(pattern []string, path []string) (bool, bool) {
+	if len(pattern) == 0 {
+		return len(path) == 0, false
+	}
+	if pattern[0] == "**" {
+		match, descendant := matchPattern(pattern[1:], path)
+		if len(path) == 0 {
+			return match, true
+		}
+		longerMatch, longerDescendant := matchPattern(pattern, path[1:])
+		return match || longerMatch, descendant || longerDescendant
+	}
+	if len(path) == 0 {
+		return false, true
+	}
+	if pattern[0] != "*" && pattern[0] != path[0] {
+		return false, false
+	}
+	return matchPattern(pattern[1:], path[1:])
+}
+
+// expand reports whether the element at path must be expanded.
+func (w *treeWalker) expand(path asn1.RelativeOID) bool {
+	if w.options.MaxDepth > 0 && len(path) >= w.options.MaxDepth {
+		return false
+	}
+	segments := make([]string, len(path))
+	for i, number := range path {
+		segments[i] = strconv.Itoa(int(number))
+	}
+	for _, pattern := range w.exclude {
+		if match, _ := matchPattern(pattern, segments); match {
+			return false
+		}
+	}
+	if len(w.include) == 0 {
+		return true
+	}
+	for _, pattern := range w.include {
+		if _, descendant := matchPattern(pattern, segments); descendant {
+			return true
+		}
+	}
+	return false
+}
+
+// received queues the children to expand and sends the next requests.
+func (w *treeWalker) received(children map[int]*embertree.Element, err errors.Error) {
+	numbers := make([]int, 0, len(children))
+	for number := range children {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	w.lock.Lock()
+	w.inFlight--
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	w.discovered += len(numbers)
+	for _, number := range numbers {
+		child := children[number]
+		// Templates have no children to expand.
+		if !child.IsTemplate() && w.expand(child.GetPath()) {
+			w.waiting = append(w.waiting, child)
+		}
+	}
+	w.lock.Unlock()
+	w.next()
+}
+
+// next sends GetDirectory requests until MaxConcurrent are in flight and calls the
+// listener once everything has been received.
+func (w *treeWalker) next() {
+	for {
+		w.lock.Lock()
+		if len(w.waiting) == 0 || (w.options.MaxConcurrent > 0 && w.inFlight >= w.options.MaxConcurrent) {
+			done := w.inFlight == 0 && len(w.waiting) == 0
+			err := w.err
+			w.lock.Unlock()
+			w.reportProgress()
+			if done {
+				w.listener.Receive(w.client.tree, err)
+			}
+			return
+		}
+		element := w.waiting[0]
+		w.waiting = w.waiting[1:]
+		w.inFlight++
+		w.lock.Unlock()
+		w.client.getLogger().Debug("GetTree GetDir for %s.\n", embertree.Path2String(element.GetPath()))
+		err := w.client.GetDirectory(element, &directoryListener{walker: w, element: element})
+		if err != nil {
+			w.lock.Lock()
+			w.inFlight--
+			if w.err == nil {
+				w.err = err
+			}
+			w.lock.Unlock()
+		}
+	}
+}
+
+// reportProgress calls Progress with the current state of the walk.
+func (w *treeWalker) reportProgress() {
+	if w.options.Progress == nil {
+		return
+	}
+	w.progressLock.Lock()
+	defer w.progressLock.Unlock()
+	w.lock.Lock()
+	progress := GetTreeProgress{Discovered: w.discovered, Outstanding: w.inFlight, Waiting: len(w.waiting)}
+	w.lock.Unlock()
+	w.options.Progress(progress)
+}
+
+// GetTree expands the whole provider tree and calls listener with the root once
+// every directory has been received.
+func (s *S101Client) GetTree(listener embertree.Listener) errors.Error {
+	return s.GetTreeWithOptions(listener, GetTreeOptions{})
+}
+
+// GetTreeWithOptions expands the part of the provider tree selected by options and
+// calls listener with the root once every directory has been received. The
+// listener gets the first error encountered, if any. Like Progress, it runs with
+// the tree locked and must not call WithTree or the blocking requests.
+func (s *S101Client) GetTreeWithOptions(listener embertree.Listener, options GetTreeOptions) errors.Error {
+	walker := &treeWalker{
+		client:   s,
+		options:  options,
+		include:  splitPatterns(options.Include),
+		exclude:  splitPatterns(options.Exclude),
+		listener: listener,
+		inFlight: 1,
+	}
+	return s.GetDirectory(nil, &directoryListener{walker: walker})
+}
+
+// GetTreeContextWithOptions is GetTreeWithOptions blocking until the tree has been
+// received or ctx is done.
+func (s *S101Client) GetTreeContextWithOptions(ctx context.Context, options GetTreeOptions) (*embertree.RootElement, errors.Error) {
+	listener := newResponseListener(nil)
+	err := s.GetTreeWithOptions(listener, options)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	_, err = listener.wait(ctx)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return s.tree, nil
+}
@@ -0,0 +1,106 @@
+package socket_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+// newDeepTestProviderTree adds 1.2.1, 1.2.1.1, 2 and 2.1 to the test provider tree.
+func newDeepTestProviderTree() *embertree.RootElement {
+	tree := newTestProviderTree()
+	_, child := tree.GetElementByPath(asn1.RelativeOID{1, 2})
+	grandChild := embertree.NewNode(1)
+	grandChild.CreateContent().(*embertree.NodeContents).SetIdentifier("grandChild")
+	parameter := embertree.NewParameter(1)
+	parameter.CreateContent().(*embertree.ParameterContents).SetIdentifier("level")
+	grandChild.AddChild(parameter)
+	child.AddChild(grandChild)
+	node := embertree.NewNode(2)
+	node.CreateContent().(*embertree.NodeContents).SetIdentifier("other")
+	otherChild := embertree.NewNode(1)
+	otherChild.CreateContent().(*embertree.NodeContents).SetIdentifier("otherChild")
+	node.AddChild(otherChild)
+	tree.AddElement(node)
+	return tree
+}
+
+func getTestTree(t *testing.T, options socket.GetTreeOptions) *embertree.RootElement {
+	server := socket.NewS101Server(newDeepTestProviderTree())
+	consumerEnd, providerEnd := net.Pipe()
+	server.ServeStream(providerEnd)
+	t.Cleanup(func() { server.Close() })
+	client := socket.NewS101Client()
+	err := client.ConnectStream(consumerEnd)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	t.Cleanup(func() { client.Disconnect() })
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	root, err := client.GetTreeContextWithOptions(ctx, options)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return root
+}
+
+func checkPaths(t *testing.T, root *embertree.RootElement, present []asn1.RelativeOID, absent []asn1.RelativeOID) {
+	for _, path := range present {
+		if _, element := root.GetElementByPath(path); element == nil {
+			t.Errorf("Element %s not received", embertree.Path2String(path))
+		}
+	}
+	for _, path := range absent {
+		if _, element := root.GetElementByPath(path); element != nil {
+			t.Errorf("Element %s should not have been received", embertree.Path2String(path))
+		}
+	}
+}
+
+func TestGetTreeMaxDepth(t *testing.T) {
+	root := getTestTree(t, socket.GetTreeOptions{MaxDepth: 2})
+	checkPaths(t, root,
+		[]asn1.RelativeOID{{1, 1}, {1, 2}, {2, 1}},
+		[]asn1.RelativeOID{{1, 2, 1}})
+}
+
+func TestGetTreeIncludeExclude(t *testing.T) {
+	root := getTestTree(t, socket.GetTreeOptions{Include: []string{"1.2.**"}})
+	checkPaths(t, root,
+		[]asn1.RelativeOID{{1, 2, 1, 1}, {2}},
+		[]asn1.RelativeOID{{2, 1}})
+
+	root = getTestTree(t, socket.GetTreeOptions{Include: []string{"*.1"}, Exclude: []string{"1"}})
+	checkPaths(t, root,
+		[]asn1.RelativeOID{{2, 1}, {1}},
+		[]asn1.RelativeOID{{1, 1}})
+
+	root = getTestTree(t, socket.GetTreeOptions{Exclude: []string{"1.2"}})
+	checkPaths(t, root,
+		[]asn1.RelativeOID{{1, 2}, {2, 1}},
+		[]asn1.RelativeOID{{1, 2, 1}})
+}
+
+func TestGetTreeProgress(t *testing.T) {
+	// Progress calls never run concurrently.
+	var reports []socket.GetTreeProgress
+	root := getTestTree(t, socket.GetTreeOptions{MaxConcurrent: 1, Progress: func(progress socket.GetTreeProgress) {
+		reports = append(reports, progress)
+	}})
+	checkPaths(t, root, []asn1.RelativeOID{{1, 2, 1, 1}, {2, 1}}, nil)
+	for _, progress := range reports {
+		if progress.Outstanding > 1 {
+			t.Errorf("%d requests outstanding with MaxConcurrent 1", progress.Outstanding)
+		}
+	}
+	last := reports[len(reports)-1]
+	if last.Discovered != 7 || last.Outstanding != 0 || last.Waiting != 0 {
+		t.Errorf("Unexpected final progress %+v", last)
+	}
+}
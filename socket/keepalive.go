@@ -0,0 +1,102 @@
+package socket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+const defaultMaxMissedKeepAlive = 3
+
+type keepAliveState struct {
+	lock      sync.Mutex
+	interval  time.Duration
+	maxMissed int
+	pending   bool
+	sentAt    time.Time
+	missed    int
+	rtt       time.Duration
+}
+
+func (k *keepAliveState) getInterval() time.Duration {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.interval
+}
+
+func (k *keepAliveState) reset() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.pending = false
+	k.missed = 0
+}
+
+// requestSent records a new request and returns false when the peer missed
+// too many responses.
+func (k *keepAliveState) requestSent() bool {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.pending {
+		k.missed++
+		if k.missed >= k.maxMissed {
+			return false
+		}
+	}
+	k.pending = true
+	k.sentAt = time.Now()
+	return true
+}
+
+func (k *keepAliveState) responseReceived() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if !k.pending {
+		return
+	}
+	k.rtt = time.Since(k.sentAt)
+	k.pending = false
+	k.missed = 0
+}
+
+// SetKeepAlive sends a keep-alive request every interval. The peer is declared dead
+// and disconnected after maxMissed requests without response. An interval of 0
+// disables keep-alive requests. It applies to the next connection.
+func (s *S101Client) SetKeepAlive(interval time.Duration, maxMissed int) {
+	if maxMissed <= 0 {
+		maxMissed = defaultMaxMissedKeepAlive
+	}
+	s.keepAlive.lock.Lock()
+	defer s.keepAlive.lock.Unlock()
+	s.keepAlive.interval = interval
+	s.keepAlive.maxMissed = maxMissed
+}
+
+// GetKeepAliveRTT returns the round trip time of the last answered keep-alive request.
+func (s *S101Client) GetKeepAliveRTT() time.Duration {
+	s.keepAlive.lock.Lock()
+	defer s.keepAlive.lock.Unlock()
+	return s.keepAlive.rtt
+}
+
+func (s *S101Client) keepAliveLoop(conn *connection, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	s.keepAlive.reset()
+	for {
+		select {
+		case <-conn.done:
+			return
+		case <-ticker.C:
+		}
+		if !s.keepAlive.requestSent() {
+			s.getLogger().Warn("Peer %s not answering keep-alive requests.\n", s.getAddress())
+			s.connectionLost(conn, errors.New("Keep-alive timeout").Message)
+			return
+		}
+		err := s.outQ.addFrameFront(s.GetFraming().KeepAliveRequest())
+		if err != nil {
+			s.getLogger().Error(err)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package socket_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func TestKeepAliveRTT(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := socket.NewS101Client()
+	client.SetKeepAlive(20*time.Millisecond, 3)
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	deadline := time.Now().Add(2 * time.Second)
+	for client.GetKeepAliveRTT() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.GetKeepAliveRTT() == 0 {
+		t.Errorf("No keep-alive round trip measured")
+	}
+	if !client.IsConnected() {
+		t.Errorf("Client disconnected while provider answers keep-alive")
+	}
+}
+
+func TestKeepAliveDeadPeer(t *testing.T) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer listener.Close()
+	go func() {
+		conn, e := listener.Accept()
+		if e == nil {
+			defer conn.Close()
+			buffer := make([]byte, 1024)
+			for {
+				if _, e = conn.Read(buffer); e != nil {
+					return
+				}
+			}
+		}
+	}()
+	client := socket.NewS101Client()
+	client.SetKeepAlive(10*time.Millisecond, 2)
+	err := client.Connect("127.0.0.1", uint16(listener.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for client.IsConnected() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.IsConnected() {
+		client.Disconnect()
+		t.Errorf("Dead peer not detected")
+	}
+}
+
+func TestKeepAliveResponse(t *testing.T) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer listener.Close()
+	received := make(chan bool, 1)
+	go func() {
+		conn, e := listener.Accept()
+		if e != nil {
+			return
+		}
+		defer conn.Close()
+		decoder := socket.NewS101Decoder(
+			func(b []byte) errors.Error { return nil },
+			func(b []byte) errors.Error { received <- true; return nil },
+			func(b []byte) errors.Error { return nil },
+			func(err errors.Error) {})
+		conn.Write(socket.GetKeepaliveRequest().Bytes())
+		buffer := make([]byte, 1024)
+		for {
+			l, e := conn.Read(buffer)
+			if e != nil {
+				return
+			}
+			decoder.DecodeBuffer(l, buffer)
+		}
+	}()
+	client := socket.NewS101Client()
+	err := client.Connect("127.0.0.1", uint16(listener.Addr().(*net.TCPAddr).Port))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Keep-alive response not sent")
+	}
+}
@@ -0,0 +1,79 @@
+package socket
+
+import (
+	"context"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// MatrixConnect adds sources to target of the matrix at path.
+func (s *S101Client) MatrixConnect(path asn1.RelativeOID, target int32, sources []int32) (*embertree.Connection, errors.Error) {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.MatrixConnectionContext(ctx, path, embertree.NewConnection(target, sources, embertree.Connect))
+}
+
+// MatrixDisconnect removes sources from target of the matrix at path.
+func (s *S101Client) MatrixDisconnect(path asn1.RelativeOID, target int32, sources []int32) (*embertree.Connection, errors.Error) {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.MatrixConnectionContext(ctx, path, embertree.NewConnection(target, sources, embertree.Disconnect))
+}
+
+// MatrixSetAbsolute replaces the sources connected to target of the matrix at path.
+func (s *S101Client) MatrixSetAbsolute(path asn1.RelativeOID, target int32, sources []int32) (*embertree.Connection, errors.Error) {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.MatrixConnectionContext(ctx, path, embertree.NewConnection(target, sources, embertree.Absolute))
+}
+
+// MatrixConnectionContext sends connection to the matrix at path and blocks until the
+// provider answers or ctx is done. The connection returned holds the sources applied
+// by the provider and the disposition. It is a copy not shared with the tree.
+func (s *S101Client) MatrixConnectionContext(ctx context.Context, path asn1.RelativeOID, connection *embertree.Connection) (*embertree.Connection, errors.Error) {
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	// Only the connections of target answer the request.
+	listener := newChangeResponseListener(element, func(event *embertree.ChangeEvent) bool {
+		return event.Element == element && findConnection(event.Connections, connection.Target) != nil
+	})
+	start := time.Now()
+	s.treeLock.Lock()
+	msg, err := element.GetConnectionMsg(connection)
+	if err == nil {
+		element.AddListener(listener)
+	}
+	s.treeLock.Unlock()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	// Sent without the tree lock as the queue may be full.
+	s.getLogger().Debug("Send connection for target %d of %s.\n", connection.Target, embertree.Path2String(path))
+	err = s.outQ.add(ctx, msg, priorityWrite, "")
+	if err != nil {
+		element.RemoveListener(listener)
+		return nil, errors.Update(err)
+	}
+	res, err := s.waitResponse(ctx, &listener.responseListener, "matrixConnection", start)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	return findConnection(res.(*embertree.ChangeEvent).Connections, connection.Target).Copy(), nil
+}
+
+// findConnection returns the connection of target in connections or nil.
+func findConnection(connections []*embertree.Connection, target int32) *embertree.Connection {
+	for _, connection := range connections {
+		if connection.Target == target {
+			return connection
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package socket_test
+
+import (
+	"testing"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+func TestMatrixConnections(t *testing.T) {
+	tree := newTestProviderTree()
+	_, node := tree.GetElementByPath(asn1.RelativeOID{1})
+	matrix, err := embertree.NewMatrix(5, embertree.NToN, embertree.Linear)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	matrix.GetContent().(*embertree.MatrixContent).SetIdentifier("router")
+	node.AddChild(matrix)
+	server, port := startTestServer(t, tree)
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	path := asn1.RelativeOID{1, 5}
+
+	tests := []struct {
+		operation   embertree.ConnectionOperation
+		sources     []int32
+		expected    []int32
+		disposition embertree.ConnectionDisposition
+	}{
+		{embertree.Absolute, []int32{1, 2}, []int32{1, 2}, embertree.Modified},
+		{embertree.Connect, []int32{3}, []int32{1, 2, 3}, embertree.Modified},
+		{embertree.Disconnect, []int32{1}, []int32{2, 3}, embertree.Modified},
+		{embertree.Absolute, []int32{2, 3}, []int32{2, 3}, embertree.Tally},
+	}
+	for _, test := range tests {
+		var connection *embertree.Connection
+		switch test.operation {
+		case embertree.Absolute:
+			connection, err = client.MatrixSetAbsolute(path, 0, test.sources)
+		case embertree.Connect:
+			connection, err = client.MatrixConnect(path, 0, test.sources)
+		case embertree.Disconnect:
+			connection, err = client.MatrixDisconnect(path, 0, test.sources)
+		}
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+		if embertree.Path2String(connection.Sources) != embertree.Path2String(test.expected) {
+			t.Errorf("Operation %d: got sources %s instead of %s", test.operation, embertree.Path2String(connection.Sources), embertree.Path2String(test.expected))
+		}
+		if connection.GetDisposition() != test.disposition {
+			t.Errorf("Operation %d: got disposition %s instead of %s", test.operation,
+				embertree.ConnectionDisposition2String(connection.GetDisposition()), embertree.ConnectionDisposition2String(test.disposition))
+		}
+	}
+	// The answer for another target is not mixed with the tree connection of target 0.
+	connection, err := client.MatrixSetAbsolute(path, 1, []int32{4})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if connection.Target != 1 || embertree.Path2String(connection.Sources) != "4" {
+		t.Errorf("Invalid connection for target 1: %d %s", connection.Target, embertree.Path2String(connection.Sources))
+	}
+	_, err = client.MatrixConnect(asn1.RelativeOID{1, 1}, 0, []int32{1})
+	if err == nil {
+		t.Errorf("Expected error connecting on a parameter")
+	}
+}
@@ -0,0 +1,224 @@
+package socket
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+const maxQueueSize = 256
+
+// Priorities of the outbound messages. Lower priorities are sent first.
+const (
+	priorityKeepAlive = iota
+	priorityWrite
+	priorityBulk
+	numPriorities
+)
+
+// queuedMessage is either BER data to frame or an already framed S101 message.
+// key identifies the messages that can be merged while pending.
+type queuedMessage struct {
+	data   []byte
+	framed bool
+	key    string
+}
+
+// packetQueue holds the messages waiting for the writer goroutine, one list per
+// priority. ready is signaled every time a message is queued. Keep-alive frames
+// do not count against limit.
+type packetQueue struct {
+	lock    sync.Mutex
+	queues  [numPriorities]*list.List
+	pending map[string]bool
+	count   int
+	limit   int
+	block   bool
+	drops   uint64
+	merged  uint64
+	ready   chan struct{}
+	// space is closed when a message leaves the queue while callers wait.
+	space   chan struct{}
+	waiters int
+}
+
+func newPacketQueue() *packetQueue {
+	var q packetQueue
+	for i := range q.queues {
+		q.queues[i] = list.New()
+	}
+	q.pending = make(map[string]bool)
+	q.limit = maxQueueSize
+	q.ready = make(chan struct{}, 1)
+	q.space = make(chan struct{})
+	return &q
+}
+
+func (p *packetQueue) size() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	size := 0
+	for _, queue := range p.queues {
+		size += queue.Len()
+	}
+	return size
+}
+
+func (p *packetQueue) isEmpty() bool {
+	return p.size() == 0
+}
+
+func (p *packetQueue) notify() {
+	select {
+	case p.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (p *packetQueue) setLimit(limit int, block bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.limit = limit
+	p.block = block
+	if p.waiters > 0 {
+		close(p.space)
+		p.space = make(chan struct{})
+		p.waiters = 0
+	}
+}
+
+// add encodes msg and queues it with priority. msg is encoded right away so it can
+// safely share data with the tree. A message with the same non empty key as a
+// pending one is merged with it. When the queue is full, add returns an error or,
+// if blocking is enabled, waits for room until ctx is done.
+func (p *packetQueue) add(ctx context.Context, msg *embertree.RootElement, priority int, key string) errors.Error {
+	return p.put(ctx, msg, priority, key, false)
+}
+
+// addWait is add always waiting for room until ctx is done when the queue is full.
+func (p *packetQueue) addWait(ctx context.Context, msg *embertree.RootElement, priority int, key string) errors.Error {
+	return p.put(ctx, msg, priority, key, true)
+}
+
+func (p *packetQueue) put(ctx context.Context, msg *embertree.RootElement, priority int, key string, wait bool) errors.Error {
+	data, err := encodeRoot(msg)
+	if err != nil {
+		return errors.Update(err)
+	}
+	p.lock.Lock()
+	for {
+		if key != "" && p.pending[key] {
+			p.merged++
+			p.lock.Unlock()
+			return nil
+		}
+		if p.count < p.limit {
+			break
+		}
+		if !p.block && !wait {
+			p.drops++
+			p.lock.Unlock()
+			return errors.New("Queue full. Message not sent.")
+		}
+		space := p.space
+		p.waiters++
+		p.lock.Unlock()
+		select {
+		case <-space:
+			p.lock.Lock()
+		case <-ctx.Done():
+			p.lock.Lock()
+			p.drops++
+			p.lock.Unlock()
+			return errors.New("Queue full. Message not sent. %s", ctx.Err())
+		}
+	}
+	p.queues[priority].PushBack(&queuedMessage{data: data, key: key})
+	p.count++
+	if key != "" {
+		p.pending[key] = true
+	}
+	p.lock.Unlock()
+	p.notify()
+	return nil
+}
+
+// addFrameFront queues an already framed S101 keep-alive message ahead of
+// everything else.
+func (p *packetQueue) addFrameFront(frame []byte) errors.Error {
+	p.lock.Lock()
+	p.queues[priorityKeepAlive].PushBack(&queuedMessage{data: frame, framed: true})
+	p.lock.Unlock()
+	p.notify()
+	return nil
+}
+
+// getDrops returns the number of messages not queued because the queue was full.
+func (p *packetQueue) getDrops() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.drops
+}
+
+// getMerged returns the number of messages merged with a pending one.
+func (p *packetQueue) getMerged() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.merged
+}
+
+// getNext returns the pending message with the highest priority or nil if the
+// queue is empty.
+func (p *packetQueue) getNext() *queuedMessage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for priority, queue := range p.queues {
+		qElement := queue.Front()
+		if qElement == nil {
+			continue
+		}
+		queue.Remove(qElement)
+		msg := qElement.Value.(*queuedMessage)
+		if priority == priorityKeepAlive {
+			return msg
+		}
+		p.count--
+		if msg.key != "" {
+			delete(p.pending, msg.key)
+		}
+		if p.waiters > 0 {
+			close(p.space)
+			p.space = make(chan struct{})
+			p.waiters = 0
+		}
+		return msg
+	}
+	return nil
+}
+
+// directoryKey is the key merging the pending GetDirectory requests for path.
+func directoryKey(path asn1.RelativeOID) string {
+	return "getDirectory " + embertree.Path2String(path)
+}
+
+// SetQueueLimit sets the number of messages waiting to be sent. When the queue
+// is full, requests block until there is room or their timeout expires if block
+// is set, and fail right away otherwise. Keep-alive messages are always queued.
+func (s *S101Client) SetQueueLimit(limit int, block bool) {
+	if limit <= 0 {
+		limit = maxQueueSize
+	}
+	s.outQ.setLimit(limit, block)
+}
+
+// queue adds msg to the outbound queue. When the queue is full, it waits at
+// most the request timeout.
+func (s *S101Client) queue(msg *embertree.RootElement, priority int, key string) errors.Error {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.outQ.add(ctx, msg, priority, key)
+}
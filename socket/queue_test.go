@@ -0,0 +1,139 @@
+package socket_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func encodeTestRoot(t *testing.T, root *embertree.RootElement) []byte {
+	writer := asn1.ASNWriter{}
+	err := root.Encode(&writer)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	data := make([]byte, writer.Len())
+	writer.Read(data)
+	return data
+}
+
+// recordPackets decodes the messages sent on stream.
+func recordPackets(stream net.Conn) chan []byte {
+	packets := make(chan []byte, 16)
+	ignore := func(packet []byte) errors.Error { return nil }
+	decoder := socket.NewS101Decoder(ignore, ignore, func(packet []byte) errors.Error {
+		packets <- packet
+		return nil
+	}, func(err errors.Error) {})
+	go decoder.ReadFrom(stream)
+	return packets
+}
+
+func newQueueTestClient() (*socket.S101Client, *embertree.Element, *embertree.Element) {
+	client := socket.NewS101Client()
+	parameter := embertree.NewParameter(1)
+	node := embertree.NewNode(2)
+	client.WithTree(func(tree *embertree.RootElement) {
+		tree.AddElement(parameter)
+		tree.AddElement(node)
+	})
+	return client, parameter, node
+}
+
+func TestQueuePriorityAndMerge(t *testing.T) {
+	client, parameter, node := newQueueTestClient()
+	// Queued while disconnected.
+	client.GetDirectory(nil, nil)
+	client.GetDirectory(node, nil)
+	client.GetDirectory(nil, nil)
+	err := client.Subscribe(asn1.RelativeOID{1})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if merges := client.GetStats().QueueMerges; merges != 1 {
+		t.Errorf("Expected 1 merged request, got %d", merges)
+	}
+
+	consumerEnd, providerEnd := net.Pipe()
+	packets := recordPackets(providerEnd)
+	err = client.ConnectStream(consumerEnd)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+
+	subscribe, _ := parameter.GetSubscribeMsg()
+	rootDirectory, _ := embertree.NewTree().GetDirectoryMsg(nil)
+	expected := [][]byte{
+		encodeTestRoot(t, subscribe),
+		encodeTestRoot(t, rootDirectory),
+		encodeTestRoot(t, node.GetQualifiedDirectoryMsg(nil)),
+	}
+	for i, data := range expected {
+		select {
+		case packet := <-packets:
+			if !bytes.Equal(packet, data) {
+				t.Errorf("Unexpected message %d %v", i, packet)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Message %d not received", i)
+		}
+	}
+	select {
+	case packet := <-packets:
+		t.Errorf("Unexpected message %v", packet)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	client, _, node := newQueueTestClient()
+	client.SetQueueLimit(1, false)
+	err := client.GetDirectory(nil, nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	err = client.GetDirectory(node, nil)
+	if err == nil {
+		t.Fatal("Expected an error when the queue is full")
+	}
+
+	client.SetQueueLimit(1, true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = client.SubscribeContext(ctx, asn1.RelativeOID{1})
+	if err == nil {
+		t.Fatal("Expected an error once the context is done")
+	}
+
+	// A blocked request is queued once the writer makes room.
+	consumerEnd, providerEnd := net.Pipe()
+	packets := recordPackets(providerEnd)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.ConnectStream(consumerEnd)
+	}()
+	defer client.Disconnect()
+	client.SetTimeout(2000)
+	err = client.GetDirectory(node, nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-packets:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Message %d not received", i)
+		}
+	}
+	if drops := client.GetStats().QueueDrops; drops != 2 {
+		t.Errorf("Expected 2 queue drops, got %d", drops)
+	}
+}
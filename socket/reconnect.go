@@ -0,0 +1,189 @@
+package socket
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+)
+
+// ReconnectPolicy describes how the client reconnects after losing its connection.
+// Delays grow exponentially from InitialDelay up to MaxDelay. Jitter is the random
+// fraction (0 to 1) applied to each delay. A MaxAttempts of 0 retries forever.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	Jitter       float64
+	MaxAttempts  int
+	// Restored is called from the reconnection goroutine once the GetDirectory
+	// requests restoring the tree have been queued. failed lists the paths not
+	// restored, the root being an empty path, because the connection was lost
+	// again.
+	Restored func(failed []asn1.RelativeOID)
+}
+
+func NewReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		InitialDelay: 500 * time.Millisecond,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		MaxAttempts:  0,
+	}
+}
+
+// Delay returns the time to wait before the given reconnection attempt (starting at 0).
+func (p *ReconnectPolicy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay)
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 0; i < attempt && (p.MaxDelay <= 0 || delay < float64(p.MaxDelay)); i++ {
+		delay *= multiplier
+	}
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	return time.Duration(delay)
+}
+
+// SetReconnectPolicy enables automatic reconnection. A nil policy disables it.
+func (s *S101Client) SetReconnectPolicy(policy *ReconnectPolicy) {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	s.reconnectPolicy = policy
+}
+
+func (s *S101Client) markExpanded(path asn1.RelativeOID) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if len(path) == 0 {
+		s.rootExpanded = true
+		return
+	}
+	s.expandedPaths[embertree.Path2String(path)] = path
+}
+
+func (s *S101Client) startReconnect() {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	if s.reconnectPolicy == nil || s.transport == nil || s.reconnectStop != nil {
+		return
+	}
+	s.reconnectStop = make(chan struct{})
+	go s.reconnect(s.reconnectPolicy, s.reconnectStop, s.transport)
+}
+
+func (s *S101Client) stopReconnect() bool {
+	s.connLock.Lock()
+	defer s.connLock.Unlock()
+	if s.reconnectStop == nil {
+		return false
+	}
+	close(s.reconnectStop)
+	s.reconnectStop = nil
+	return true
+}
+
+func (s *S101Client) reconnect(policy *ReconnectPolicy, stop chan struct{}, transport Transport) {
+	for attempt := 0; policy.MaxAttempts <= 0 || attempt < policy.MaxAttempts; attempt++ {
+		delay := policy.Delay(attempt)
+		s.getLogger().Info("Reconnecting to %s in %s (attempt %d).\n", transport, delay, attempt+1)
+		select {
+		case <-time.After(delay):
+		case <-stop:
+			return
+		}
+		stream, err := transport.Open()
+		if err != nil {
+			s.getLogger().Warn("Reconnection to %s failed. %s\n", transport, err.Message)
+			continue
+		}
+		s.connLock.Lock()
+		select {
+		case <-stop:
+			s.connLock.Unlock()
+			stream.Close()
+			return
+		default:
+		}
+		s.reconnectStop = nil
+		s.start(stream)
+		conn := s.conn
+		s.connLock.Unlock()
+		failed := s.restoreState(conn)
+		if policy.Restored != nil {
+			policy.Restored(failed)
+		}
+		s.getLogger().Info("Reconnected to %s.\n", transport)
+		return
+	}
+	s.connLock.Lock()
+	if s.reconnectStop == stop {
+		s.reconnectStop = nil
+	}
+	s.connLock.Unlock()
+	s.getLogger().Warn("Giving up reconnecting to %s.\n", transport)
+}
+
+// restoreState re-issues a GetDirectory for the root and every expanded element,
+// parents first, so the local tree gets refreshed by the provider. Active
+// subscriptions are then sent again. The requests wait for room in the queue
+// until conn is lost. The paths that could not be queued are returned.
+func (s *S101Client) restoreState(conn *connection) []asn1.RelativeOID {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-conn.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	s.stateLock.Lock()
+	rootExpanded := s.rootExpanded
+	paths := []asn1.RelativeOID{}
+	for _, path := range s.expandedPaths {
+		paths = append(paths, path)
+	}
+	s.stateLock.Unlock()
+	failed := []asn1.RelativeOID{}
+	if rootExpanded {
+		msg, err := s.tree.GetDirectoryMsg(nil)
+		if err == nil {
+			err = s.outQ.addWait(ctx, msg, priorityBulk, directoryKey(nil))
+		}
+		if err != nil {
+			s.getLogger().Error(err)
+			failed = append(failed, asn1.RelativeOID{})
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool { return len(paths[i]) < len(paths[j]) })
+	for _, path := range paths {
+		s.treeLock.Lock()
+		_, element := s.tree.GetElementByPath(path)
+		s.treeLock.Unlock()
+		if element == nil {
+			continue
+		}
+		s.getLogger().Debug("Restoring directory %s.\n", embertree.Path2String(path))
+		err := s.outQ.addWait(ctx, element.GetQualifiedDirectoryMsg(nil), priorityBulk, directoryKey(path))
+		if err != nil {
+			s.getLogger().Error(err)
+			failed = append(failed, path)
+		}
+	}
+	s.restoreSubscriptions(ctx)
+	return failed
+}
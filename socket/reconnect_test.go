@@ -0,0 +1,157 @@
+package socket_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	policy := &socket.ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for attempt, delay := range expected {
+		if policy.Delay(attempt) != delay {
+			t.Errorf("Invalid delay %s for attempt %d. Expected %s", policy.Delay(attempt), attempt, delay)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(0)
+		if delay < 50*time.Millisecond || delay > 150*time.Millisecond {
+			t.Errorf("Delay %s outside of jitter range", delay)
+			return
+		}
+	}
+}
+
+func TestReconnectRestoresTree(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	client := socket.NewS101Client()
+	restored := make(chan []asn1.RelativeOID, 1)
+	client.SetReconnectPolicy(&socket.ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2,
+		Restored: func(failed []asn1.RelativeOID) { restored <- failed }})
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	node, err := client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 2})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	server.Close()
+
+	// The provider comes back with a modified tree.
+	tree := newTestProviderTree()
+	_, child := tree.GetElementByPath(asn1.RelativeOID{1, 2})
+	child.GetContent().(*embertree.NodeContents).SetIdentifier("rebooted")
+	server = socket.NewS101Server(tree)
+	err = server.Listen("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer server.Close()
+
+	select {
+	case failed := <-restored:
+		if len(failed) != 0 {
+			t.Errorf("Paths not restored %v", failed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Restoration not reported")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var identifier string
+		client.WithTree(func(tree *embertree.RootElement) {
+			identifier, _ = node.GetContent().(*embertree.NodeContents).GetIdentifier()
+		})
+		if identifier == "rebooted" && client.IsConnected() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("Tree not restored after reconnection. Connected: %t", client.IsConnected())
+}
+
+func TestDisconnectStopsReconnect(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	client := socket.NewS101Client()
+	client.SetReconnectPolicy(&socket.ReconnectPolicy{InitialDelay: 50 * time.Millisecond, Multiplier: 1})
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	server.Close()
+	time.Sleep(20 * time.Millisecond)
+	err = client.Disconnect()
+	if err != nil {
+		t.Errorf("Disconnect failed. %s", err.Message)
+	}
+	server = socket.NewS101Server(newTestProviderTree())
+	err = server.Listen("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer server.Close()
+	time.Sleep(150 * time.Millisecond)
+	if client.IsConnected() {
+		t.Errorf("Client reconnected after Disconnect")
+	}
+}
+
+func TestReconnectRestoresLargeTree(t *testing.T) {
+	newTree := func() *embertree.RootElement {
+		tree := newTestProviderTree()
+		_, node := tree.GetElementByPath(asn1.RelativeOID{1})
+		for i := 10; i < 310; i++ {
+			child := embertree.NewNode(i)
+			child.CreateContent().(*embertree.NodeContents).SetIdentifier("node" + strconv.Itoa(i))
+			node.AddChild(child)
+		}
+		return tree
+	}
+	server, port := startTestServer(t, newTree())
+	client := socket.NewS101Client()
+	restored := make(chan []asn1.RelativeOID, 1)
+	client.SetReconnectPolicy(&socket.ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2,
+		Restored: func(failed []asn1.RelativeOID) { restored <- failed }})
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.GetTreeContextWithOptions(ctx, socket.GetTreeOptions{MaxConcurrent: 32})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	server.Close()
+	server = socket.NewS101Server(newTree())
+	err = server.Listen("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer server.Close()
+
+	// More expanded paths than the queue holds are restored without drops.
+	select {
+	case failed := <-restored:
+		if len(failed) != 0 {
+			t.Errorf("%d paths not restored", len(failed))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Restoration not reported")
+	}
+	if drops := client.GetStats().QueueDrops; drops != 0 {
+		t.Errorf("%d messages dropped while restoring", drops)
+	}
+}
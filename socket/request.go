@@ -0,0 +1,377 @@
+package socket
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// defaultRequestTimeout is used by blocking requests when no timeout has been set
+// with SetTimeout.
+const defaultRequestTimeout = 5 * time.Second
+
+type response struct {
+	node interface{}
+	err  errors.Error
+}
+
+// responseListener is a one shot listener removing itself from the
+// node it is attached to once a response has been received.
+type responseListener struct {
+	node embertree.ListeningNode
+	// listener is the listener registered on node. It is the responseListener
+	// itself or the listener embedding it.
+	listener embertree.Listener
+	response chan response
+}
+
+func newResponseListener(node embertree.ListeningNode) *responseListener {
+	l := &responseListener{node: node, response: make(chan response, 1)}
+	l.listener = l
+	return l
+}
+
+func (l *responseListener) Receive(node interface{}, err errors.Error) {
+	if l.node != nil {
+		l.node.RemoveListener(l.listener)
+	}
+	select {
+	case l.response <- response{node: node, err: err}:
+	default:
+	}
+}
+
+// changeResponseListener is a one shot listener completing on the first update
+// event accepted by match, or on an error. The event is the response.
+type changeResponseListener struct {
+	responseListener
+	match func(event *embertree.ChangeEvent) bool
+}
+
+func newChangeResponseListener(node embertree.ListeningNode, match func(event *embertree.ChangeEvent) bool) *changeResponseListener {
+	l := &changeResponseListener{match: match}
+	l.node = node
+	l.listener = l
+	l.response = make(chan response, 1)
+	return l
+}
+
+func (l *changeResponseListener) ReceiveUpdate(event *embertree.ChangeEvent, err errors.Error) {
+	if err == nil && !l.match(event) {
+		return
+	}
+	l.Receive(event, err)
+}
+
+// waitResponse waits for the response of a request sent at start and records
+// its latency under command.
+func (s *S101Client) waitResponse(ctx context.Context, listener *responseListener, command string, start time.Time) (interface{}, errors.Error) {
+	res, err := listener.wait(ctx)
+	s.recordRequest(command, start, err)
+	return res, err
+}
+
+func (l *responseListener) wait(ctx context.Context) (interface{}, errors.Error) {
+	select {
+	case res := <-l.response:
+		return res.node, res.err
+	case <-ctx.Done():
+		if l.node != nil {
+			l.node.RemoveListener(l.listener)
+		}
+		return nil, errors.NewError(ctx.Err())
+	}
+}
+
+// GetRootDirectoryContext sends a GetDirectory for the root and blocks until the
+// provider answers or ctx is done.
+func (s *S101Client) GetRootDirectoryContext(ctx context.Context) (*embertree.RootElement, errors.Error) {
+	listener := newResponseListener(s.tree)
+	msg, err := s.tree.GetDirectoryMsg(listener)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.markExpanded(nil)
+	start := time.Now()
+	err = s.outQ.add(ctx, msg, priorityBulk, directoryKey(nil))
+	if err != nil {
+		s.tree.RemoveListener(listener)
+		return nil, errors.Update(err)
+	}
+	_, err = s.waitResponse(ctx, listener, "getDirectory", start)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return s.tree, nil
+}
+
+// GetDirectoryContext sends a GetDirectory for the element at path and blocks until
+// the provider answers or ctx is done. Missing branches of the path are fetched first.
+func (s *S101Client) GetDirectoryContext(ctx context.Context, path asn1.RelativeOID) (*embertree.Element, errors.Error) {
+	if len(path) == 0 {
+		return nil, errors.New("Invalid empty path. Use GetRootDirectoryContext for the root.")
+	}
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.getLogger().Debug("Send GetDirectory for %s.\n", embertree.Path2String(path))
+	listener := newResponseListener(element)
+	s.markExpanded(path)
+	start := time.Now()
+	err = s.outQ.add(ctx, element.GetQualifiedDirectoryMsg(listener), priorityBulk, directoryKey(path))
+	if err != nil {
+		element.RemoveListener(listener)
+		return nil, errors.Update(err)
+	}
+	_, err = s.waitResponse(ctx, listener, "getDirectory", start)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return element, nil
+}
+
+// GetTreeContext expands the whole provider tree and blocks until it has been
+// received or ctx is done.
+func (s *S101Client) GetTreeContext(ctx context.Context) (*embertree.RootElement, errors.Error) {
+	return s.GetTreeContextWithOptions(ctx, GetTreeOptions{})
+}
+
+// getElementContext returns the element at path from the local tree. Branches
+// not yet received are fetched from the provider.
+func (s *S101Client) getElementContext(ctx context.Context, path asn1.RelativeOID) (*embertree.Element, errors.Error) {
+	var err errors.Error
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	s.treeLock.Unlock()
+	if element != nil {
+		return element, nil
+	}
+	if len(path) == 1 {
+		_, err = s.GetRootDirectoryContext(ctx)
+	} else {
+		_, err = s.GetDirectoryContext(ctx, path[:len(path)-1])
+	}
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.treeLock.Lock()
+	_, element = s.tree.GetElementByPath(path)
+	s.treeLock.Unlock()
+	if element == nil {
+		return nil, errors.New("Element %s not found.", embertree.Path2String(path))
+	}
+	return element, nil
+}
+
+func (s *S101Client) defaultContext() (context.Context, context.CancelFunc) {
+	timeout := s.getTimeout()
+	if timeout <= 0 {
+		timeout = defaultRequestTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// SetValue changes the value of the parameter at path and waits for the provider
+// to echo it. The value returned is the one applied by the provider.
+func (s *S101Client) SetValue(path asn1.RelativeOID, value interface{}) (*embertree.ContentParameter, errors.Error) {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.SetValueContext(ctx, path, value)
+}
+
+// SetValueContext changes the value of the parameter at path and blocks until the
+// provider echoes it or ctx is done. value is converted to the parameter type.
+// Values the parameter can't accept are rejected without being sent. The value
+// returned is the one reported by the provider, which may have clamped or
+// rejected the write.
+func (s *S101Client) SetValueContext(ctx context.Context, path asn1.RelativeOID, value interface{}) (*embertree.ContentParameter, errors.Error) {
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	// Any echo of the value completes the write, even if the value did not change.
+	listener := newChangeResponseListener(element, func(event *embertree.ChangeEvent) bool {
+		return event.Element == element && event.HasReceived("value")
+	})
+	start := time.Now()
+	s.treeLock.Lock()
+	// Rejected locally as providers usually ignore invalid values silently.
+	if contents, ok := element.GetContent().(*embertree.ParameterContents); ok {
+		err = contents.ValidateValue(value)
+	}
+	var msg *embertree.RootElement
+	if err == nil {
+		msg, err = element.GetSetValueMsg(value)
+	}
+	if err == nil {
+		element.AddListener(listener)
+	}
+	s.treeLock.Unlock()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.getLogger().Debug("Send SetValue for %s.\n", embertree.Path2String(path))
+	err = s.outQ.add(ctx, msg, priorityWrite, "")
+	if err != nil {
+		element.RemoveListener(listener)
+		return nil, errors.Update(err)
+	}
+	_, err = s.waitResponse(ctx, &listener.responseListener, "setValue", start)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	contents, ok := element.GetContent().(*embertree.ParameterContents)
+	if !ok || !contents.GetValueObject().IsSet() {
+		return nil, errors.New("No value received for %s.", embertree.Path2String(path))
+	}
+	applied := embertree.NewContentParameter()
+	err = applied.Set(contents.GetValueObject())
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return applied, nil
+}
+
+// Invoke calls the function at path and waits for its result. The arguments are
+// converted to the argument types of the function.
+func (s *S101Client) Invoke(path asn1.RelativeOID, arguments ...interface{}) (*embertree.InvocationResult, errors.Error) {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.InvokeContext(ctx, path, arguments...)
+}
+
+// InvokeContext calls the function at path and blocks until the provider returns the
+// InvocationResult or ctx is done. The result values are converted to the result
+// types of the function.
+func (s *S101Client) InvokeContext(ctx context.Context, path asn1.RelativeOID, arguments ...interface{}) (*embertree.InvocationResult, errors.Error) {
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	id := int(atomic.AddInt32(&s.lastInvocationID, 1))
+	s.treeLock.Lock()
+	msg, contents, err := getInvokeMsg(element, id, arguments)
+	s.treeLock.Unlock()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.getLogger().Debug("Send Invoke %d for %s.\n", id, embertree.Path2String(path))
+	listener := newResponseListener(nil)
+	s.tree.AddInvocationListener(id, listener)
+	start := time.Now()
+	err = s.outQ.add(ctx, msg, priorityWrite, "")
+	if err == nil {
+		var res interface{}
+		res, err = s.waitResponse(ctx, listener, "invoke", start)
+		if err == nil {
+			result := res.(*embertree.InvocationResult)
+			if !result.GetSuccess() {
+				return result, nil
+			}
+			s.treeLock.Lock()
+			values, err := contents.ConvertResult(result.GetResult())
+			s.treeLock.Unlock()
+			if err != nil {
+				return nil, errors.Update(err)
+			}
+			result.SetResult(values)
+			return result, nil
+		}
+	}
+	s.tree.RemoveInvocationListener(id)
+	return nil, errors.Update(err)
+}
+
+func getInvokeMsg(element *embertree.Element, id int, arguments []interface{}) (*embertree.RootElement, *embertree.FunctionContents, errors.Error) {
+	contents, ok := element.GetContent().(*embertree.FunctionContents)
+	if !ok {
+		return nil, nil, errors.New("Element %s is not a function.", embertree.Path2String(element.GetPath()))
+	}
+	values, err := contents.NewArguments(arguments)
+	if err != nil {
+		return nil, nil, errors.Update(err)
+	}
+	msg, err := element.GetInvokeMsg(embertree.NewInvocation(id, values))
+	if err != nil {
+		return nil, nil, errors.Update(err)
+	}
+	return msg, contents, nil
+}
+
+// Resolve returns the element at the path of identifiers separated by "/", like
+// "Router/Matrices/Video", and its numeric path. A GetDirectory is only sent for
+// the branches missing from the local tree.
+func (s *S101Client) Resolve(ctx context.Context, path string) (*embertree.Element, asn1.RelativeOID, errors.Error) {
+	identifiers := embertree.SplitIdentifierPath(path)
+	if len(identifiers) == 0 {
+		return nil, nil, errors.New("Invalid empty identifier path.")
+	}
+	var parent *embertree.Element
+	for _, identifier := range identifiers {
+		element := s.getChildByIdentifier(parent, identifier)
+		if element == nil {
+			var err errors.Error
+			if parent == nil {
+				_, err = s.GetRootDirectoryContext(ctx)
+			} else {
+				_, err = s.GetDirectoryContext(ctx, s.getPath(parent))
+			}
+			if err != nil {
+				return nil, nil, errors.Update(err)
+			}
+			element = s.getChildByIdentifier(parent, identifier)
+		}
+		if element == nil {
+			return nil, nil, errors.New("Identifier %s of %s not found.", identifier, path)
+		}
+		parent = element
+	}
+	return parent, s.getPath(parent), nil
+}
+
+// getChildByIdentifier looks for identifier in the local tree below parent, or
+// at the root if parent is nil.
+func (s *S101Client) getChildByIdentifier(parent *embertree.Element, identifier string) *embertree.Element {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	if parent == nil {
+		return s.tree.GetElementByIdentifier(identifier)
+	}
+	return parent.GetChildByIdentifier(identifier)
+}
+
+func (s *S101Client) getPath(element *embertree.Element) asn1.RelativeOID {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	return element.GetPath()
+}
+
+// GetTemplateContext returns the template referenced by the element at path.
+// The element and the template are fetched from the provider if missing from
+// the local tree.
+func (s *S101Client) GetTemplateContext(ctx context.Context, path asn1.RelativeOID) (*embertree.TemplateContents, errors.Error) {
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.treeLock.Lock()
+	reference, err := element.GetTemplateReference()
+	s.treeLock.Unlock()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	_, err = s.getElementContext(ctx, reference)
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	return s.tree.GetTemplate(element)
+}
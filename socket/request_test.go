@@ -0,0 +1,279 @@
+package socket_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func connectTestClient(t *testing.T, port uint16) *socket.S101Client {
+	client := socket.NewS101Client()
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return client
+}
+
+func TestGetDirectoryContext(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	element, err := client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 2})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	identifier, _ := element.GetContent().(*embertree.NodeContents).GetIdentifier()
+	if identifier != "child" {
+		t.Errorf("Invalid identifier %s", identifier)
+	}
+	_, err = client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 9})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown path")
+	}
+}
+
+func TestGetTreeContext(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	root, err := client.GetTreeContext(ctx)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	_, parameter := root.GetElementByPath(asn1.RelativeOID{1, 1})
+	if parameter == nil || parameter.GetContent() == nil {
+		t.Errorf("Parameter 1.1 not received")
+	}
+}
+
+func TestGetDirectoryContextDeadline(t *testing.T) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer listener.Close()
+	go func() {
+		// accept and never answer
+		conn, e := listener.Accept()
+		if e == nil {
+			defer conn.Close()
+			buffer := make([]byte, 1024)
+			for {
+				if _, e = conn.Read(buffer); e != nil {
+					return
+				}
+			}
+		}
+	}()
+	client := connectTestClient(t, uint16(listener.Addr().(*net.TCPAddr).Port))
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetRootDirectoryContext(ctx)
+	if err == nil {
+		t.Fatal("Expected a deadline error")
+	}
+	if err.Message != context.DeadlineExceeded {
+		t.Errorf("Unexpected error %s", err.Message)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Deadline not honored")
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	tree := newTestProviderTree()
+	_, gain := tree.GetElementByPath(asn1.RelativeOID{1, 1})
+	gain.GetContent().(*embertree.ParameterContents).GetMaximumObject().SetInt(100)
+	server, port := startTestServer(t, tree)
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	value, err := client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, 42)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	i, err := value.GetInt()
+	if err != nil || i != 42 {
+		t.Errorf("Invalid value applied %s", value.ToString())
+	}
+	i, _ = gain.GetContent().(*embertree.ParameterContents).GetValueObject().GetInt()
+	if i != 42 {
+		t.Errorf("Provider value not changed. Got %d", i)
+	}
+
+	// Writing the current value completes on the echo of the provider.
+	value, err = client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, 42)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ = value.GetInt(); i != 42 {
+		t.Errorf("Invalid unchanged value %s", value.ToString())
+	}
+
+	// Out of range values are rejected before being sent.
+	_, err = client.SetValue(asn1.RelativeOID{1, 1}, 500)
+	if err == nil {
+		t.Errorf("Expected error writing a value above maximum")
+	}
+
+	_, err = client.SetValue(asn1.RelativeOID{1, 1}, "loud")
+	if err == nil {
+		t.Errorf("Expected error writing a string to an integer parameter")
+	}
+	_, err = client.SetValue(asn1.RelativeOID{1, 2}, 1)
+	if err == nil {
+		t.Errorf("Expected error writing a value to a node")
+	}
+}
+
+func TestSetValueClampedOrRejected(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, 20)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	// The consumer is not told about the new range so the write is sent.
+	server.UpdateTree(func(tree *embertree.RootElement) {
+		_, gain := tree.GetElementByPath(asn1.RelativeOID{1, 1})
+		gain.GetContent().(*embertree.ParameterContents).GetMaximumObject().SetInt(50)
+	})
+	value, err := client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, 80)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != 50 {
+		t.Errorf("Expected clamped value 50. Got %s", value.ToString())
+	}
+
+	// A rejected write is echoed with the unchanged value.
+	server.UpdateTree(func(tree *embertree.RootElement) {
+		_, gain := tree.GetElementByPath(asn1.RelativeOID{1, 1})
+		gain.GetContent().(*embertree.ParameterContents).SetAccess(embertree.ParameterAccessRead)
+	})
+	value, err = client.SetValueContext(ctx, asn1.RelativeOID{1, 1}, 10)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if i, _ := value.GetInt(); i != 50 {
+		t.Errorf("Expected unchanged value 50. Got %s", value.ToString())
+	}
+}
+
+func TestInvoke(t *testing.T) {
+	tree := newTestProviderTree()
+	_, node := tree.GetElementByPath(asn1.RelativeOID{1})
+	function := embertree.NewFunction(3)
+	contents := function.CreateContent().(*embertree.FunctionContents)
+	contents.SetIdentifier("add")
+	contents.SetArguments([]*embertree.TupleDescription{
+		embertree.NewArgument(embertree.ParameterTypeInteger, "a"),
+		embertree.NewArgument(embertree.ParameterTypeInteger, "b")})
+	contents.SetResult([]*embertree.TupleDescription{embertree.NewArgument(embertree.ParameterTypeReal, "sum")})
+	node.AddChild(function)
+	server, port := startTestServer(t, tree)
+	defer server.Close()
+	server.SetFunctionHandler(asn1.RelativeOID{1, 3}, func(arguments []*embertree.ContentParameter) ([]*embertree.ContentParameter, errors.Error) {
+		a, _ := arguments[0].GetInt()
+		b, _ := arguments[1].GetInt()
+		if b == 0 {
+			return nil, errors.New("Invalid argument")
+		}
+		sum := embertree.NewContentParameter()
+		sum.SetInt(a + b)
+		return []*embertree.ContentParameter{sum}, nil
+	})
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	result, err := client.Invoke(asn1.RelativeOID{1, 3}, 40, 2)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !result.GetSuccess() || len(result.GetResult()) != 1 {
+		t.Fatal("Invalid invocation result")
+	}
+	sum, err := result.GetResult()[0].GetReal()
+	if err != nil || sum != 42 {
+		t.Errorf("Invalid result %s", result.GetResult()[0].ToString())
+	}
+	result, err = client.Invoke(asn1.RelativeOID{1, 3}, 40, 0)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if result.GetSuccess() {
+		t.Errorf("Expected failed invocation")
+	}
+	_, err = client.Invoke(asn1.RelativeOID{1, 3}, 40)
+	if err == nil {
+		t.Errorf("Expected error with missing argument")
+	}
+	_, err = client.Invoke(asn1.RelativeOID{1, 1}, 40)
+	if err == nil {
+		t.Errorf("Expected error invoking a parameter")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	server := socket.NewS101Server(newDeepTestProviderTree())
+	consumerEnd, providerEnd := net.Pipe()
+	server.ServeStream(providerEnd)
+	defer server.Close()
+	client := socket.NewS101Client()
+	err := client.ConnectStream(consumerEnd)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	element, path, err := client.Resolve(ctx, "gdnet/child/grandChild/level")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if embertree.Path2String(path) != "1.2.1.1" || element == nil {
+		t.Errorf("Unexpected path %s", embertree.Path2String(path))
+	}
+	// Root, gdnet, child and grandChild.
+	if count := client.GetStats().Requests["getDirectory"].Count; count != 4 {
+		t.Errorf("Expected 4 GetDirectory, got %d", count)
+	}
+
+	// Already in the local tree.
+	_, path, err = client.Resolve(ctx, "/gdnet/gain")
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if embertree.Path2String(path) != "1.1" {
+		t.Errorf("Unexpected path %s", embertree.Path2String(path))
+	}
+	if count := client.GetStats().Requests["getDirectory"].Count; count != 4 {
+		t.Errorf("Expected no new GetDirectory, got %d", count-4)
+	}
+
+	_, _, err = client.Resolve(ctx, "gdnet/missing")
+	if err == nil {
+		t.Errorf("Expected an error for an unknown identifier")
+	}
+}
@@ -0,0 +1,620 @@
+package socket
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	. "github.com/dufourgilles/emberlib/logger"
+)
+
+// FunctionHandler executes a function invoked by a consumer. The arguments have
+// the types declared by the function. A returned error reports a failed invocation.
+type FunctionHandler func(arguments []*embertree.ContentParameter) ([]*embertree.ContentParameter, errors.Error)
+
+// S101Server is an Ember+ provider serving a local tree to S101 consumers.
+type S101Server struct {
+	tree      *embertree.RootElement
+	functions map[string]FunctionHandler
+	treeLock  sync.Mutex
+	// listenerLock guards listener.
+	listenerLock sync.Mutex
+	listener     net.Listener
+	clients      map[*s101ServerClient]*s101ServerClient
+	clientsLock  sync.Mutex
+	logger       Logger
+}
+
+type s101ServerClient struct {
+	server        *S101Server
+	conn          io.ReadWriteCloser
+	name          string
+	decoder       *S101Decoder
+	stats         S101SocketStats
+	writeLock     sync.Mutex
+	subscriptions map[string]bool // protected by server.clientsLock
+}
+
+func NewS101Server(tree *embertree.RootElement) *S101Server {
+	if tree == nil {
+		tree = embertree.NewTree()
+	}
+	return &S101Server{
+		tree:      tree,
+		functions: make(map[string]FunctionHandler),
+		clients:   make(map[*s101ServerClient]*s101ServerClient),
+		logger:    NewNullLogger(),
+	}
+}
+
+func (s *S101Server) SetLogger(logger Logger) {
+	if logger != nil {
+		s.logger = logger
+	}
+}
+
+// UpdateTree calls f with the served tree while the server is not using it.
+// Consumers are not notified of the changes made by f. Use SetValue to change a
+// value and send it to the consumers.
+func (s *S101Server) UpdateTree(f func(tree *embertree.RootElement)) {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	f(s.tree)
+}
+
+// SetValue changes the value of the parameter at path and sends it to all
+// consumers. Unlike the values received from consumers, the access and the range
+// are not checked.
+func (s *S101Server) SetValue(path asn1.RelativeOID, value interface{}) errors.Error {
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	if element == nil {
+		s.treeLock.Unlock()
+		return errors.New("SetValue for unknown path %s.", embertree.Path2String(path))
+	}
+	contents, ok := element.GetContent().(*embertree.ParameterContents)
+	if !ok {
+		s.treeLock.Unlock()
+		return errors.New("SetValue for %s which is not a parameter.", embertree.Path2String(path))
+	}
+	newValue, err := embertree.NewValue(value, contents.GetValueType())
+	if err == nil {
+		err = contents.GetValueObject().Set(newValue)
+	}
+	var data []byte
+	if err == nil {
+		data, err = s.encodeValue(element)
+	}
+	s.treeLock.Unlock()
+	if err != nil {
+		return errors.Update(err)
+	}
+	s.broadcast(data)
+	return nil
+}
+
+// encodeValue encodes the message sending the value of the parameter element.
+func (s *S101Server) encodeValue(element *embertree.Element) ([]byte, errors.Error) {
+	response, err := element.GetSetValueMsg(element.GetContent().(*embertree.ParameterContents).GetValueObject())
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return encodeRoot(response)
+}
+
+// SetFunctionHandler registers the handler executing the function at path.
+func (s *S101Server) SetFunctionHandler(path asn1.RelativeOID, handler FunctionHandler) {
+	s.treeLock.Lock()
+	defer s.treeLock.Unlock()
+	s.functions[embertree.Path2String(path)] = handler
+}
+
+func (s *S101Server) Listen(address string, port uint16) errors.Error {
+	if addr := s.Addr(); addr != nil {
+		return errors.New("Server already listening on %s.", addr)
+	}
+	listener, e := net.Listen("tcp", fmt.Sprintf("%s:%d", address, port))
+	if e != nil {
+		return errors.NewError(e)
+	}
+	err := s.Serve(listener)
+	if err != nil {
+		listener.Close()
+	}
+	return err
+}
+
+// Serve accepts consumers on listener, for instance a Unix domain socket listener.
+func (s *S101Server) Serve(listener net.Listener) errors.Error {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+	if s.listener != nil {
+		return errors.New("Server already listening on %s.", s.listener.Addr())
+	}
+	s.listener = listener
+	go s.acceptLoop(listener)
+	return nil
+}
+
+// ServeStream serves a single consumer connected through stream, such as a serial
+// line or a net.Pipe end. It returns immediately.
+func (s *S101Server) ServeStream(stream io.ReadWriteCloser) {
+	s.addClient(stream, "stream")
+}
+
+// Addr returns the address the server is listening on or nil.
+func (s *S101Server) Addr() net.Addr {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Close stops listening and disconnects all consumers, including those served
+// with ServeStream.
+func (s *S101Server) Close() errors.Error {
+	var err error
+	s.listenerLock.Lock()
+	listener := s.listener
+	s.listener = nil
+	s.listenerLock.Unlock()
+	if listener != nil {
+		err = listener.Close()
+	}
+	s.clientsLock.Lock()
+	count := len(s.clients)
+	for client := range s.clients {
+		client.conn.Close()
+	}
+	s.clientsLock.Unlock()
+	if listener == nil && count == 0 {
+		return errors.New("Server not listening.")
+	}
+	return errors.NewError(err)
+}
+
+func (s *S101Server) ClientCount() int {
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	return len(s.clients)
+}
+
+// SubscriberCount returns the number of consumers subscribed to the element at path.
+func (s *S101Server) SubscriberCount(path asn1.RelativeOID) int {
+	key := embertree.Path2String(path)
+	count := 0
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	for client := range s.clients {
+		if client.subscriptions[key] {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *S101Server) acceptLoop(listener net.Listener) {
+	s.logger.Debug("Server accepting connections on %s.\n", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.logger.Debug("Server stopped accepting connections. %s\n", err)
+			return
+		}
+		s.addClient(conn, conn.RemoteAddr().String())
+	}
+}
+
+func (s *S101Server) addClient(conn io.ReadWriteCloser, name string) {
+	client := &s101ServerClient{server: s, conn: conn, name: name, subscriptions: make(map[string]bool)}
+	client.decoder = NewS101Decoder(client.keepAliveReqHandler, client.keepAliveResponseHandler, client.emberPacketHandler, client.errorHandler)
+	client.decoder.SetLogger(s.logger)
+	client.stats.Reset()
+	s.clientsLock.Lock()
+	s.clients[client] = client
+	s.clientsLock.Unlock()
+	go client.run()
+}
+
+func (s *S101Server) removeClient(client *s101ServerClient) {
+	s.clientsLock.Lock()
+	delete(s.clients, client)
+	s.clientsLock.Unlock()
+}
+
+func (c *s101ServerClient) run() {
+	c.server.logger.Debug("Consumer %s connected.\n", c.name)
+	c.decoder.ReadFrom(&countingReader{reader: c.conn, update: func(n int) {
+		c.stats.RxBytes += uint64(n)
+		c.stats.RxPackets++
+	}})
+	c.conn.Close()
+	c.server.removeClient(c)
+	c.server.logger.Debug("Consumer %s disconnected.\n", c.name)
+}
+
+func (c *s101ServerClient) sendBER(data []byte) errors.Error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	return sendBERFrames(c.conn, data, c.decoder.GetFraming(), &c.stats)
+}
+
+func (c *s101ServerClient) keepAliveReqHandler(kal []byte) errors.Error {
+	c.server.logger.Debug("KAL Request Received.\n")
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	_, err := c.conn.Write(c.decoder.GetFraming().KeepAliveResponse())
+	if err != nil {
+		c.stats.TxErrors++
+		return errors.NewError(err)
+	}
+	return nil
+}
+
+func (c *s101ServerClient) keepAliveResponseHandler(kal []byte) errors.Error {
+	c.server.logger.Debug("KAL Response Received.\n")
+	return nil
+}
+
+func (c *s101ServerClient) errorHandler(err errors.Error) {
+	c.server.logger.Error(err)
+}
+
+func (c *s101ServerClient) emberPacketHandler(packet []byte) errors.Error {
+	elements, err := embertree.DecodeRootElementCollection(asn1.NewASNReader(packet))
+	if err != nil {
+		c.errorHandler(err)
+		return errors.Update(err)
+	}
+	for _, element := range elements {
+		err = c.server.handleRequest(c, element)
+		if err != nil {
+			c.errorHandler(err)
+		}
+	}
+	return err
+}
+
+func (s *S101Server) handleRequest(client *s101ServerClient, element *embertree.Element) errors.Error {
+	if element.GetTag() == embertree.CommandApplication {
+		return s.handleCommand(client, nil, element)
+	}
+	if embertree.GetUnqualifiedTag(element.GetTag()) == embertree.ParameterApplication {
+		contents, ok := element.GetContent().(*embertree.ParameterContents)
+		if ok && contents.GetValueObject().IsSet() {
+			err := s.handleSetValue(element.GetPath(), contents.GetValueObject())
+			if err != nil {
+				return errors.Update(err)
+			}
+		}
+	}
+	if embertree.GetUnqualifiedTag(element.GetTag()) == embertree.MatrixApplication {
+		connections, _ := element.GetConnections()
+		if len(connections) > 0 {
+			err := s.handleConnections(element.GetPath(), connections)
+			if err != nil {
+				return errors.Update(err)
+			}
+		}
+	}
+	for _, child := range element.Children {
+		var err errors.Error
+		if child.GetTag() == embertree.CommandApplication {
+			err = s.handleCommand(client, element.GetPath(), child)
+		} else {
+			err = s.handleRequest(client, child)
+		}
+		if err != nil {
+			return errors.Update(err)
+		}
+	}
+	return nil
+}
+
+func (s *S101Server) handleCommand(client *s101ServerClient, path asn1.RelativeOID, command *embertree.Element) errors.Error {
+	switch command.Number {
+	case embertree.COMMAND_GETDIRECTORY:
+		return s.handleGetDirectory(client, path)
+	case embertree.COMMAND_SUBSCRIBE, embertree.COMMAND_UNSUBSCRIBE:
+		return s.handleSubscribe(client, path, command.Number == embertree.COMMAND_SUBSCRIBE)
+	case embertree.COMMAND_INVOKE:
+		contents, ok := command.GetContent().(*embertree.CommandContents)
+		if !ok || contents.GetInvocation() == nil {
+			return errors.New("Invoke without invocation for %s.", embertree.Path2String(path))
+		}
+		return s.handleInvoke(client, path, contents.GetInvocation())
+	default:
+		return errors.New("Unsupported command %d for %s.", command.Number, embertree.Path2String(path))
+	}
+}
+
+func (s *S101Server) handleGetDirectory(client *s101ServerClient, path asn1.RelativeOID) errors.Error {
+	var response *embertree.RootElement
+	s.logger.Debug("GetDirectory received for '%s'.\n", embertree.Path2String(path))
+	s.treeLock.Lock()
+	if len(path) == 0 {
+		response = s.tree.GetDirectoryResponse()
+	} else {
+		_, element := s.tree.GetElementByPath(path)
+		if element == nil {
+			s.logger.Warn("GetDirectory for unknown path %s.\n", embertree.Path2String(path))
+			response = s.unknownPathResponse(path)
+		} else {
+			response = element.GetDirectoryResponse()
+		}
+	}
+	data, err := encodeRoot(response)
+	s.treeLock.Unlock()
+	if err != nil {
+		return errors.Update(err)
+	}
+	return client.sendBER(data)
+}
+
+func (s *S101Server) handleSubscribe(client *s101ServerClient, path asn1.RelativeOID, subscribe bool) errors.Error {
+	s.logger.Debug("Subscribe %t received for '%s'.\n", subscribe, embertree.Path2String(path))
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	if element == nil {
+		s.logger.Warn("Subscribe for unknown path %s.\n", embertree.Path2String(path))
+		data, err := encodeRoot(s.unknownPathResponse(path))
+		s.treeLock.Unlock()
+		if err != nil {
+			return errors.Update(err)
+		}
+		return client.sendBER(data)
+	}
+	s.treeLock.Unlock()
+	s.clientsLock.Lock()
+	defer s.clientsLock.Unlock()
+	if subscribe {
+		client.subscriptions[embertree.Path2String(path)] = true
+	} else {
+		delete(client.subscriptions, embertree.Path2String(path))
+	}
+	return nil
+}
+
+// unknownPathResponse answers a request for a path missing from the tree with
+// the directory of its deepest existing parent, or an empty root, so that the
+// consumer does not wait for its timeout. The tree must be locked.
+func (s *S101Server) unknownPathResponse(path asn1.RelativeOID) *embertree.RootElement {
+	for i := len(path) - 1; i > 0; i-- {
+		_, parent := s.tree.GetElementByPath(path[:i])
+		if parent != nil {
+			return parent.GetDirectoryResponse()
+		}
+	}
+	return embertree.NewRoot()
+}
+
+// handleInvoke executes the function at path and returns the InvocationResult to
+// the consumer.
+func (s *S101Server) handleInvoke(client *s101ServerClient, path asn1.RelativeOID, invocation *embertree.Invocation) errors.Error {
+	s.logger.Debug("Invoke %d received for '%s'.\n", invocation.GetID(), embertree.Path2String(path))
+	result := embertree.NewInvocationResult(invocation.GetID(), false, nil)
+	s.treeLock.Lock()
+	handler := s.functions[embertree.Path2String(path)]
+	var contents *embertree.FunctionContents
+	_, element := s.tree.GetElementByPath(path)
+	if element != nil {
+		contents, _ = element.GetContent().(*embertree.FunctionContents)
+	}
+	s.treeLock.Unlock()
+	if handler == nil || contents == nil {
+		s.logger.Warn("No function at %s.\n", embertree.Path2String(path))
+	} else {
+		args := []interface{}{}
+		for _, argument := range invocation.GetArguments() {
+			args = append(args, argument)
+		}
+		values, err := contents.NewArguments(args)
+		if err == nil {
+			values, err = handler(values)
+		}
+		if err == nil {
+			values, err = contents.ConvertResult(values)
+		}
+		if err != nil {
+			s.logger.Warn("Invocation %d of %s failed. %s\n", invocation.GetID(), embertree.Path2String(path), err.Message)
+		} else {
+			result = embertree.NewInvocationResult(invocation.GetID(), true, values)
+		}
+	}
+	data, err := encodeRoot(embertree.NewInvocationResultRoot(result))
+	if err != nil {
+		return errors.Update(err)
+	}
+	return client.sendBER(data)
+}
+
+// handleConnections applies connection requests on the matrix at path and sends the
+// resulting connections of the modified targets to all consumers.
+func (s *S101Server) handleConnections(path asn1.RelativeOID, connections []*embertree.Connection) errors.Error {
+	s.logger.Debug("Connections received for '%s'.\n", embertree.Path2String(path))
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	if element == nil {
+		s.treeLock.Unlock()
+		return errors.New("Connections for unknown path %s.", embertree.Path2String(path))
+	}
+	matrixType := embertree.OneToN
+	if contents, ok := element.GetContent().(*embertree.MatrixContent); ok {
+		if t, err := contents.GetType(); err == nil {
+			matrixType = t
+		}
+	}
+	response := embertree.NewQualifiedMatrix(path, matrixType, embertree.Linear)
+	results := []*embertree.Connection{}
+	for _, connection := range connections {
+		results = append(results, applyConnection(element, matrixType, connection))
+	}
+	response.SetConnections(results)
+	root := embertree.NewRoot()
+	root.AddElement(response)
+	data, err := encodeRoot(root)
+	s.treeLock.Unlock()
+	if err != nil {
+		return errors.Update(err)
+	}
+	s.broadcast(data)
+	return nil
+}
+
+// applyConnection applies request on the matrix and returns the resulting connection
+// of the target.
+func applyConnection(matrix *embertree.Element, matrixType embertree.MatrixType, request *embertree.Connection) *embertree.Connection {
+	current := matrix.GetConnection(request.Target)
+	sources := []int32{}
+	if current != nil {
+		sources = append(sources, current.Sources...)
+	}
+	switch request.GetOperation() {
+	case embertree.Absolute:
+		sources = append([]int32{}, request.Sources...)
+	case embertree.Connect:
+		for _, source := range request.Sources {
+			if !containsSource(sources, source) {
+				sources = append(sources, source)
+			}
+		}
+	case embertree.Disconnect:
+		remaining := []int32{}
+		for _, source := range sources {
+			if !containsSource(request.Sources, source) {
+				remaining = append(remaining, source)
+			}
+		}
+		sources = remaining
+	}
+	if matrixType != embertree.NToN && len(sources) > 1 {
+		// Only the last source requested can stay connected.
+		sources = sources[len(sources)-1:]
+	}
+	result := embertree.NewConnection(request.Target, sources, embertree.Absolute)
+	if current != nil && sameSources(current.Sources, sources) {
+		result.SetDisposition(int(embertree.Tally))
+	} else {
+		result.SetDisposition(int(embertree.Modified))
+	}
+	connections, _ := matrix.GetConnections()
+	replaced := false
+	for i, connection := range connections {
+		if connection.Target == request.Target {
+			connections[i] = result
+			replaced = true
+		}
+	}
+	if !replaced {
+		connections = append(connections, result)
+	}
+	matrix.SetConnections(connections)
+	return result
+}
+
+func containsSource(sources []int32, source int32) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func sameSources(a []int32, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// handleSetValue applies a value received from a consumer and sends the resulting
+// value to all consumers. Values out of range are clamped and invalid values are
+// ignored, in both cases the value actually applied is sent back.
+func (s *S101Server) handleSetValue(path asn1.RelativeOID, value *embertree.ContentParameter) errors.Error {
+	s.logger.Debug("SetValue received for '%s'.\n", embertree.Path2String(path))
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	if element == nil {
+		s.treeLock.Unlock()
+		return errors.New("SetValue for unknown path %s.", embertree.Path2String(path))
+	}
+	contents, ok := element.GetContent().(*embertree.ParameterContents)
+	if !ok {
+		s.treeLock.Unlock()
+		return errors.New("SetValue for %s which is not a parameter.", embertree.Path2String(path))
+	}
+	err := applyValue(contents, value)
+	if err != nil {
+		s.logger.Warn("SetValue for %s rejected. %s\n", embertree.Path2String(path), err.Message)
+	}
+	data, err := s.encodeValue(element)
+	s.treeLock.Unlock()
+	if err != nil {
+		return errors.Update(err)
+	}
+	s.broadcast(data)
+	return nil
+}
+
+func applyValue(contents *embertree.ParameterContents, value *embertree.ContentParameter) errors.Error {
+	// Unset access is read.
+	access, _ := contents.GetAccess()
+	if !access.IsWritable() {
+		return errors.New("Parameter is not writable.")
+	}
+	newValue, err := embertree.NewValue(value, contents.GetValueType())
+	if err != nil {
+		return errors.Update(err)
+	}
+	clampValue(newValue, contents.GetMinimumObject(), contents.GetMaximumObject())
+	return contents.GetValueObject().Set(newValue)
+}
+
+func clampValue(value *embertree.ContentParameter, minimum *embertree.ContentParameter, maximum *embertree.ContentParameter) {
+	switch value.GetType() {
+	case embertree.ValueTypeInteger:
+		i, _ := value.GetInt()
+		if lowest, err := minimum.GetInt(); err == nil && i < lowest {
+			value.SetInt(lowest)
+		}
+		if highest, err := maximum.GetInt(); err == nil && i > highest {
+			value.SetInt(highest)
+		}
+	case embertree.ValueTypeReal:
+		r, _ := value.GetReal()
+		if lowest, err := minimum.GetReal(); err == nil && r < lowest {
+			value.SetReal(lowest)
+		}
+		if highest, err := maximum.GetReal(); err == nil && r > highest {
+			value.SetReal(highest)
+		}
+	}
+}
+
+// broadcast sends an encoded message to all connected consumers.
+func (s *S101Server) broadcast(data []byte) {
+	s.clientsLock.Lock()
+	clients := make([]*s101ServerClient, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsLock.Unlock()
+	for _, client := range clients {
+		err := client.sendBER(data)
+		if err != nil {
+			s.logger.Error(err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package socket_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func newTestProviderTree() *embertree.RootElement {
+	tree := embertree.NewTree()
+	node := embertree.NewNode(1)
+	nodeContents := node.CreateContent().(*embertree.NodeContents)
+	nodeContents.SetIdentifier("gdnet")
+	parameter := embertree.NewParameter(1)
+	parameterContents := parameter.CreateContent().(*embertree.ParameterContents)
+	parameterContents.SetIdentifier("gain")
+	parameterContents.GetValueObject().SetInt(77)
+	parameterContents.SetAccess(embertree.ParameterAccessReadWrite)
+	node.AddChild(parameter)
+	child := embertree.NewNode(2)
+	childContents := child.CreateContent().(*embertree.NodeContents)
+	childContents.SetIdentifier("child")
+	node.AddChild(child)
+	tree.AddElement(node)
+	return tree
+}
+
+func startTestServer(t *testing.T, tree *embertree.RootElement) (*socket.S101Server, uint16) {
+	server := socket.NewS101Server(tree)
+	err := server.Listen("127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return server, uint16(server.Addr().(*net.TCPAddr).Port)
+}
+
+type treeListener struct {
+	root *embertree.RootElement
+	done chan errors.Error
+}
+
+func (l *treeListener) Receive(node interface{}, err errors.Error) {
+	if root, ok := node.(*embertree.RootElement); ok {
+		l.root = root
+	}
+	l.done <- err
+}
+
+func TestServerGetTree(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := socket.NewS101Client()
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	listener := &treeListener{done: make(chan errors.Error, 1)}
+	err = client.GetTree(listener)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	select {
+	case err = <-listener.done:
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GetTree timed out")
+	}
+	_, parameter := listener.root.GetElementByPath(asn1.RelativeOID{1, 1})
+	if parameter == nil {
+		t.Fatal("Parameter 1.1 not received")
+	}
+	value, err := parameter.GetContent().(*embertree.ParameterContents).GetValueObject().GetInt()
+	if err != nil || value != 77 {
+		t.Errorf("Invalid parameter value %d", value)
+	}
+	_, node := listener.root.GetElementByPath(asn1.RelativeOID{1, 2})
+	if node == nil {
+		t.Fatal("Node 1.2 not received")
+	}
+	identifier, _ := node.GetContent().(*embertree.NodeContents).GetIdentifier()
+	if identifier != "child" {
+		t.Errorf("Invalid node identifier %s", identifier)
+	}
+	if server.ClientCount() != 1 {
+		t.Errorf("Invalid client count %d", server.ClientCount())
+	}
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	server, _ := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	conn, e := net.Dial("tcp", server.Addr().String())
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer conn.Close()
+	conn.Write(socket.GetKeepaliveRequest().Bytes())
+	received := make(chan []byte, 1)
+	decoder := socket.NewS101Decoder(
+		func(b []byte) errors.Error { return nil },
+		func(b []byte) errors.Error { received <- b; return nil },
+		func(b []byte) errors.Error { return nil },
+		func(err errors.Error) {})
+	buffer := make([]byte, 256)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	l, e := conn.Read(buffer)
+	if e != nil {
+		t.Fatal(e)
+	}
+	decoder.DecodeBuffer(l, buffer)
+	select {
+	case <-received:
+	default:
+		t.Errorf("Keep-alive response not received")
+	}
+}
+
+type valueListener struct {
+	done chan errors.Error
+}
+
+func (l *valueListener) Receive(node interface{}, err errors.Error) {
+	l.done <- err
+}
+
+func TestServerSetValue(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := socket.NewS101Client()
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	node, err := client.GetDirectoryContext(ctx, asn1.RelativeOID{1})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	listener := &valueListener{done: make(chan errors.Error, 1)}
+	var gain *embertree.Element
+	client.WithTree(func(tree *embertree.RootElement) {
+		gain = node.Children[1]
+		gain.AddListener(listener)
+	})
+
+	err = server.SetValue(asn1.RelativeOID{1, 1}, 12)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	select {
+	case <-listener.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Value not received")
+	}
+	client.WithTree(func(tree *embertree.RootElement) {
+		value, _ := gain.GetContent().(*embertree.ParameterContents).GetValueObject().GetInt()
+		if value != 12 {
+			t.Errorf("Unexpected value %d", value)
+		}
+	})
+	server.UpdateTree(func(tree *embertree.RootElement) {
+		_, element := tree.GetElementByPath(asn1.RelativeOID{1, 1})
+		value, _ := element.GetContent().(*embertree.ParameterContents).GetValueObject().GetInt()
+		if value != 12 {
+			t.Errorf("Provider value not changed. Got %d", value)
+		}
+	})
+	if err = server.SetValue(asn1.RelativeOID{1, 2}, 1); err == nil {
+		t.Error("Expected an error setting the value of a node")
+	}
+}
+
+func TestServerUnknownPath(t *testing.T) {
+	server, _ := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	conn, e := net.Dial("tcp", server.Addr().String())
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer conn.Close()
+	received := make(chan []byte, 1)
+	decoder := socket.NewS101Decoder(
+		func(b []byte) errors.Error { return nil },
+		func(b []byte) errors.Error { return nil },
+		func(b []byte) errors.Error { received <- b; return nil },
+		func(err errors.Error) {})
+	request := embertree.NewQualifiedNode(asn1.RelativeOID{1, 9, 3}).GetQualifiedDirectoryMsg(nil)
+	frames := socket.EncodeMessage(encodeTestRoot(t, request))
+	for i := 0; i < frames.Size(); i++ {
+		frame, _ := frames.GetBytesAt(i)
+		conn.Write(frame)
+	}
+	buffer := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		l, e := conn.Read(buffer)
+		if e != nil {
+			t.Fatal("No answer for an unknown path.")
+		}
+		decoder.DecodeBuffer(l, buffer)
+		select {
+		case packet := <-received:
+			// The deepest existing parent is returned.
+			response := embertree.NewTree()
+			if err := response.Decode(asn1.NewASNReader(packet)); err != nil {
+				t.Fatal(err.Message)
+			}
+			if element := response.GetElementByNumber(1); element == nil {
+				t.Error("Parent 1 not returned for an unknown path")
+			}
+			return
+		default:
+		}
+	}
+}
@@ -1,11 +1,54 @@
 package socket
 
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// RequestLatency holds the latency of the requests sent with one command.
+type RequestLatency struct {
+	// Count is the number of answered requests and Failures the number of
+	// requests failing or timing out once sent.
+	Count    uint64
+	Failures uint64
+	Total    time.Duration
+	Max      time.Duration
+	Last     time.Duration
+}
+
+// Average returns the average latency of the answered requests.
+func (l RequestLatency) Average() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
 type S101SocketStats struct {
 	TxPackets uint64
 	RxPackets uint64
 	TxBytes	uint64
 	RxBytes uint64
-	TxErrors uint64	
+	TxErrors uint64
+	// CRCErrors counts the escaping frames with an invalid CRC.
+	CRCErrors uint64
+	// InvalidFrames counts the frames with a valid framing but an unexpected content.
+	InvalidFrames uint64
+	// DroppedFrames counts the incomplete frames and the frames of incomplete
+	// multi-packet messages.
+	DroppedFrames uint64
+	// Reassemblies counts the messages received in several frames.
+	Reassemblies uint64
+	// QueueDrops counts the messages not sent because the queue was full.
+	QueueDrops uint64
+	// QueueMerges counts the requests merged with an identical pending request.
+	QueueMerges uint64
+	KeepAliveRTT time.Duration
+	// Requests holds the latency of the blocking requests by command.
+	Requests map[string]RequestLatency
 }
 
 func (s *S101SocketStats)Reset() {
@@ -14,4 +57,95 @@ func (s *S101SocketStats)Reset() {
 	s.TxPackets = 0
 	s.RxBytes = 0
 	s.RxPackets = 0
-}
\ No newline at end of file
+	s.CRCErrors = 0
+	s.InvalidFrames = 0
+	s.DroppedFrames = 0
+	s.Reassemblies = 0
+	s.QueueDrops = 0
+	s.QueueMerges = 0
+	s.KeepAliveRTT = 0
+	s.Requests = nil
+}
+
+// Snapshot returns a copy of the statistics not sharing the request latencies.
+func (s *S101SocketStats)Snapshot() S101SocketStats {
+	snapshot := *s
+	snapshot.Requests = make(map[string]RequestLatency, len(s.Requests))
+	for command, latency := range s.Requests {
+		snapshot.Requests[command] = latency
+	}
+	return snapshot
+}
+
+func (s *S101SocketStats)recordRequest(command string, latency time.Duration, failed bool) {
+	if s.Requests == nil {
+		s.Requests = make(map[string]RequestLatency)
+	}
+	entry := s.Requests[command]
+	if failed {
+		entry.Failures++
+	} else {
+		entry.Count++
+		entry.Total += latency
+		entry.Last = latency
+		if latency > entry.Max {
+			entry.Max = latency
+		}
+	}
+	s.Requests[command] = entry
+}
+
+var prometheusCounters = []struct {
+	name string
+	help string
+	value func(s *S101SocketStats) uint64
+}{
+	{"tx_packets_total", "Frames sent.", func(s *S101SocketStats) uint64 { return s.TxPackets }},
+	{"rx_packets_total", "Reads from the connection.", func(s *S101SocketStats) uint64 { return s.RxPackets }},
+	{"tx_bytes_total", "Bytes sent.", func(s *S101SocketStats) uint64 { return s.TxBytes }},
+	{"rx_bytes_total", "Bytes received.", func(s *S101SocketStats) uint64 { return s.RxBytes }},
+	{"tx_errors_total", "Send errors.", func(s *S101SocketStats) uint64 { return s.TxErrors }},
+	{"crc_errors_total", "Frames received with an invalid CRC.", func(s *S101SocketStats) uint64 { return s.CRCErrors }},
+	{"invalid_frames_total", "Frames received with an unexpected content.", func(s *S101SocketStats) uint64 { return s.InvalidFrames }},
+	{"dropped_frames_total", "Incomplete frames and multi-packet messages dropped.", func(s *S101SocketStats) uint64 { return s.DroppedFrames }},
+	{"reassemblies_total", "Messages received in several frames.", func(s *S101SocketStats) uint64 { return s.Reassemblies }},
+	{"queue_drops_total", "Messages dropped because the send queue was full.", func(s *S101SocketStats) uint64 { return s.QueueDrops }},
+	{"queue_merges_total", "Requests merged with an identical pending request.", func(s *S101SocketStats) uint64 { return s.QueueMerges }},
+}
+
+// WritePrometheus writes the statistics in the Prometheus text exposition format.
+// Metric names start with prefix followed by an underscore.
+func (s *S101SocketStats)WritePrometheus(w io.Writer, prefix string) error {
+	out := bufio.NewWriter(w)
+	for _, counter := range prometheusCounters {
+		name := prefix + "_" + counter.name
+		fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, counter.help, name, name, counter.value(s))
+	}
+	name := prefix + "_keepalive_rtt_seconds"
+	fmt.Fprintf(out, "# HELP %s Round trip time of the last answered keep-alive request.\n# TYPE %s gauge\n%s %g\n",
+		name, name, name, s.KeepAliveRTT.Seconds())
+
+	commands := make([]string, 0, len(s.Requests))
+	for command := range s.Requests {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	name = prefix + "_request_duration_seconds"
+	fmt.Fprintf(out, "# HELP %s Latency of the answered requests.\n# TYPE %s summary\n", name, name)
+	for _, command := range commands {
+		latency := s.Requests[command]
+		fmt.Fprintf(out, "%s_sum{command=%q} %g\n%s_count{command=%q} %d\n",
+			name, command, latency.Total.Seconds(), name, command, latency.Count)
+	}
+	name = prefix + "_request_duration_max_seconds"
+	fmt.Fprintf(out, "# HELP %s Highest latency of the answered requests.\n# TYPE %s gauge\n", name, name)
+	for _, command := range commands {
+		fmt.Fprintf(out, "%s{command=%q} %g\n", name, command, s.Requests[command].Max.Seconds())
+	}
+	name = prefix + "_request_failures_total"
+	fmt.Fprintf(out, "# HELP %s Requests without answer.\n# TYPE %s counter\n", name, name)
+	for _, command := range commands {
+		fmt.Fprintf(out, "%s{command=%q} %d\n", name, command, s.Requests[command].Failures)
+	}
+	return out.Flush()
+}
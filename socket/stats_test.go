@@ -0,0 +1,101 @@
+package socket_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func TestDecoderStats(t *testing.T) {
+	packets := 0
+	decoder := socket.NewS101Decoder(
+		func(packet []byte) errors.Error { return nil },
+		func(packet []byte) errors.Error { return nil },
+		func(packet []byte) errors.Error { packets++; return nil },
+		func(err errors.Error) {})
+	var stream []byte
+	// Invalid CRC.
+	stream = append(stream, 254, 0, 14, 0, 1, 192, 1, 2, 31, 2, 1, 2, 3, 4, 163, 215, 255)
+	// Frame interrupted by the next one.
+	stream = append(stream, 254, 0, 14, 0)
+	// Unknown command.
+	stream = append(stream, socket.NonEscapingFraming.KeepAliveRequest()...)
+	stream[len(stream)-2] = 9
+	// Multi-packet message.
+	large := make([]byte, 3000)
+	frames := socket.EncodeMessage(large)
+	for i := 0; i < frames.Size(); i++ {
+		frame, _ := frames.GetBytesAt(i)
+		stream = append(stream, frame...)
+	}
+	// Last packet without the first ones.
+	frame, _ := socket.EncodeMessage(large).GetBytesAt(frames.Size() - 1)
+	stream = append(stream, frame...)
+	decoder.DecodeBuffer(len(stream), stream)
+
+	stats := decoder.GetStats()
+	if stats.CRCErrors != 1 || stats.DroppedFrames != 2 || stats.InvalidFrames != 1 || stats.Reassemblies != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if packets != 1 {
+		t.Errorf("Expected 1 packet, got %d", packets)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	server := socket.NewS101Server(newTestProviderTree())
+	consumerEnd, providerEnd := net.Pipe()
+	server.ServeStream(providerEnd)
+	defer server.Close()
+	client := socket.NewS101Client()
+	err := client.ConnectStream(consumerEnd)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	// Root, node 1 and node 1.2.
+	checkGetDirectory(t, client)
+
+	stats := client.GetStats()
+	latency := stats.Requests["getDirectory"]
+	if latency.Count != 3 || latency.Failures != 0 || latency.Max <= 0 || latency.Average() > latency.Max {
+		t.Errorf("Unexpected getDirectory latency %+v", latency)
+	}
+	var out bytes.Buffer
+	e := client.WritePrometheus(&out)
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, line := range []string{
+		"# TYPE emberplus_s101_crc_errors_total counter\nemberplus_s101_crc_errors_total 0\n",
+		"emberplus_s101_request_duration_seconds_count{command=\"getDirectory\"} 3\n",
+		"emberplus_s101_request_failures_total{command=\"getDirectory\"} 0\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Missing %q in\n%s", line, out.String())
+		}
+	}
+}
+
+func TestClientQueueDrops(t *testing.T) {
+	client := socket.NewS101Client()
+	// Distinct nodes so the requests are not merged.
+	nodes := make([]*embertree.Element, 300)
+	client.WithTree(func(tree *embertree.RootElement) {
+		for i := range nodes {
+			nodes[i] = embertree.NewNode(i)
+			tree.AddElement(nodes[i])
+		}
+	})
+	for _, node := range nodes {
+		client.GetDirectory(node, nil)
+	}
+	if drops := client.GetStats().QueueDrops; drops != 300-256 {
+		t.Errorf("Expected %d queue drops, got %d", 300-256, drops)
+	}
+}
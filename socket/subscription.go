@@ -0,0 +1,188 @@
+package socket
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// Subscription is an active subscription and the number of Subscribe calls
+// not yet matched by an Unsubscribe.
+type Subscription struct {
+	Path  asn1.RelativeOID
+	Count int
+}
+
+type subscriptions struct {
+	lock    sync.Mutex
+	entries map[string]*Subscription
+	// pending holds the Subscribe commands being queued. Later Subscribe calls
+	// for the same path wait for their result.
+	pending map[string]*pendingSubscribe
+}
+
+// pendingSubscribe is closed once the first Subscribe of a path has been queued,
+// or has failed with err.
+type pendingSubscribe struct {
+	done chan struct{}
+	err  errors.Error
+}
+
+// Subscribe subscribes to the stream parameter or matrix at path. Subscriptions
+// are reference counted. The command is only sent on the first subscription.
+func (s *S101Client) Subscribe(path asn1.RelativeOID) errors.Error {
+	ctx, cancel := s.defaultContext()
+	defer cancel()
+	return s.SubscribeContext(ctx, path)
+}
+
+// SubscribeContext is Subscribe fetching the missing branches of path within ctx.
+func (s *S101Client) SubscribeContext(ctx context.Context, path asn1.RelativeOID) errors.Error {
+	element, err := s.getElementContext(ctx, path)
+	if err != nil {
+		return errors.Update(err)
+	}
+	msg, err := element.GetSubscribeMsg()
+	if err != nil {
+		return errors.Update(err)
+	}
+	key := embertree.Path2String(path)
+	s.subscriptions.lock.Lock()
+	subscription := s.subscriptions.entries[key]
+	if subscription != nil {
+		subscription.Count++
+		pending := s.subscriptions.pending[key]
+		s.subscriptions.lock.Unlock()
+		if pending == nil {
+			return nil
+		}
+		select {
+		case <-pending.done:
+			if pending.err != nil {
+				// The failed send already released the count.
+				return errors.New("Subscribe for %s not sent. %s", key, pending.err.Message)
+			}
+			return nil
+		case <-ctx.Done():
+			s.releaseSubscription(key, subscription)
+			return errors.NewError(ctx.Err())
+		}
+	}
+	// Registered before sending so the lock is not held while the queue is full.
+	subscription = &Subscription{Path: element.GetPath(), Count: 1}
+	pending := &pendingSubscribe{done: make(chan struct{})}
+	s.subscriptions.entries[key] = subscription
+	s.subscriptions.pending[key] = pending
+	s.subscriptions.lock.Unlock()
+	s.getLogger().Debug("Send Subscribe for %s.\n", key)
+	err = s.outQ.add(ctx, msg, priorityWrite, "")
+	s.subscriptions.lock.Lock()
+	delete(s.subscriptions.pending, key)
+	if err != nil {
+		// Every count taken while the command was pending is rolled back.
+		err = errors.Update(err)
+		pending.err = err
+		if s.subscriptions.entries[key] == subscription {
+			delete(s.subscriptions.entries, key)
+		}
+	}
+	close(pending.done)
+	s.subscriptions.lock.Unlock()
+	return err
+}
+
+// releaseSubscription rolls back a Subscribe call that gave up waiting for the
+// command to be sent.
+func (s *S101Client) releaseSubscription(key string, subscription *Subscription) {
+	s.subscriptions.lock.Lock()
+	defer s.subscriptions.lock.Unlock()
+	subscription.Count--
+	if subscription.Count <= 0 && s.subscriptions.entries[key] == subscription {
+		delete(s.subscriptions.entries, key)
+	}
+}
+
+// Unsubscribe releases a subscription. The command is only sent when the last
+// subscription to path is released.
+func (s *S101Client) Unsubscribe(path asn1.RelativeOID) errors.Error {
+	key := embertree.Path2String(path)
+	s.subscriptions.lock.Lock()
+	subscription := s.subscriptions.entries[key]
+	if subscription == nil {
+		s.subscriptions.lock.Unlock()
+		return errors.New("No subscription for %s.", key)
+	}
+	if subscription.Count > 1 {
+		subscription.Count--
+		s.subscriptions.lock.Unlock()
+		return nil
+	}
+	s.treeLock.Lock()
+	_, element := s.tree.GetElementByPath(path)
+	s.treeLock.Unlock()
+	if element == nil {
+		s.subscriptions.lock.Unlock()
+		return errors.New("Element %s not found.", key)
+	}
+	msg, err := element.GetUnsubscribeMsg()
+	if err != nil {
+		s.subscriptions.lock.Unlock()
+		return errors.Update(err)
+	}
+	delete(s.subscriptions.entries, key)
+	s.subscriptions.lock.Unlock()
+	s.getLogger().Debug("Send Unsubscribe for %s.\n", key)
+	err = s.queue(msg, priorityWrite, "")
+	if err != nil {
+		// The provider still sends the updates. Restore the subscription.
+		s.subscriptions.lock.Lock()
+		if current := s.subscriptions.entries[key]; current != nil {
+			current.Count++
+		} else {
+			s.subscriptions.entries[key] = subscription
+		}
+		s.subscriptions.lock.Unlock()
+		return errors.Update(err)
+	}
+	return nil
+}
+
+// GetSubscriptions returns the active subscriptions sorted by path.
+func (s *S101Client) GetSubscriptions() []Subscription {
+	s.subscriptions.lock.Lock()
+	defer s.subscriptions.lock.Unlock()
+	list := []Subscription{}
+	for _, subscription := range s.subscriptions.entries {
+		list = append(list, *subscription)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return embertree.Path2String(list[i].Path) < embertree.Path2String(list[j].Path)
+	})
+	return list
+}
+
+// restoreSubscriptions sends again the Subscribe command for all active
+// subscriptions, waiting for room in the queue until ctx is done.
+func (s *S101Client) restoreSubscriptions(ctx context.Context) {
+	for _, subscription := range s.GetSubscriptions() {
+		key := embertree.Path2String(subscription.Path)
+		s.treeLock.Lock()
+		_, element := s.tree.GetElementByPath(subscription.Path)
+		s.treeLock.Unlock()
+		if element == nil {
+			continue
+		}
+		msg, err := element.GetSubscribeMsg()
+		if err == nil {
+			s.getLogger().Debug("Restoring subscription %s.\n", key)
+			err = s.outQ.addWait(ctx, msg, priorityWrite, "")
+		}
+		if err != nil {
+			s.getLogger().Error(err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package socket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/embertree"
+	"github.com/dufourgilles/emberlib/errors"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func waitSubscriberCount(server *socket.S101Server, path asn1.RelativeOID, count int) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if server.SubscriberCount(path) == count {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestSubscribeRefCount(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	client := connectTestClient(t, port)
+	defer client.Disconnect()
+	path := asn1.RelativeOID{1, 1}
+	for i := 0; i < 2; i++ {
+		err := client.Subscribe(path)
+		if err != nil {
+			t.Fatal(err.Message)
+		}
+	}
+	subscriptions := client.GetSubscriptions()
+	if len(subscriptions) != 1 || subscriptions[0].Count != 2 || embertree.Path2String(subscriptions[0].Path) != "1.1" {
+		t.Fatalf("Invalid subscriptions %v", subscriptions)
+	}
+	if !waitSubscriberCount(server, path, 1) {
+		t.Fatal("Subscribe not received by the provider")
+	}
+	err := client.Unsubscribe(path)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if server.SubscriberCount(path) != 1 {
+		t.Errorf("Unsubscribe sent while still subscribed")
+	}
+	err = client.Unsubscribe(path)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !waitSubscriberCount(server, path, 0) {
+		t.Errorf("Unsubscribe not received by the provider")
+	}
+	if len(client.GetSubscriptions()) != 0 {
+		t.Errorf("Subscription not released")
+	}
+	err = client.Unsubscribe(path)
+	if err == nil {
+		t.Errorf("Expected error unsubscribing twice")
+	}
+	err = client.Subscribe(asn1.RelativeOID{1, 2})
+	if err == nil {
+		t.Errorf("Expected error subscribing to a node")
+	}
+}
+
+func TestSubscriptionRestoredAfterReconnect(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	client := socket.NewS101Client()
+	client.SetReconnectPolicy(&socket.ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2})
+	err := client.Connect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	path := asn1.RelativeOID{1, 1}
+	err = client.Subscribe(path)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if !waitSubscriberCount(server, path, 1) {
+		t.Fatal("Subscribe not received by the provider")
+	}
+	server.Close()
+	server = socket.NewS101Server(newTestProviderTree())
+	err = server.Listen("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer server.Close()
+	if !waitSubscriberCount(server, path, 1) {
+		t.Errorf("Subscription not restored after reconnection")
+	}
+}
+
+func TestSubscribeBlockedQueue(t *testing.T) {
+	client, _, _ := newQueueTestClient()
+	client.SetQueueLimit(1, true)
+	err := client.GetDirectory(nil, nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	done := make(chan errors.Error, 1)
+	go func() {
+		done <- client.SubscribeContext(ctx, asn1.RelativeOID{1})
+	}()
+	// The subscriptions are not locked while Subscribe waits for room in the queue.
+	listed := make(chan []socket.Subscription, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		listed <- client.GetSubscriptions()
+	}()
+	select {
+	case <-listed:
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("GetSubscriptions blocked by a pending Subscribe")
+	}
+	if err = <-done; err == nil {
+		t.Fatal("Expected an error once the context is done")
+	}
+	if len(client.GetSubscriptions()) != 0 {
+		t.Errorf("Subscription not rolled back")
+	}
+}
+
+func TestSubscribeWaitsForPendingSend(t *testing.T) {
+	client, _, _ := newQueueTestClient()
+	client.SetQueueLimit(1, true)
+	err := client.GetDirectory(nil, nil)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	first := make(chan errors.Error, 1)
+	go func() {
+		first <- client.SubscribeContext(ctx, asn1.RelativeOID{1})
+	}()
+	// The second call is made while the first Subscribe waits for the queue.
+	time.Sleep(50 * time.Millisecond)
+	second, cancelSecond := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancelSecond()
+	if err = client.SubscribeContext(second, asn1.RelativeOID{1}); err == nil {
+		t.Error("Expected the error of the pending Subscribe")
+	}
+	if err = <-first; err == nil {
+		t.Fatal("Expected an error once the context is done")
+	}
+	if len(client.GetSubscriptions()) != 0 {
+		t.Errorf("Subscriptions not rolled back %v", client.GetSubscriptions())
+	}
+}
@@ -0,0 +1,139 @@
+package socket
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// TLSOptions describes TLS settings with PEM files. CAFile holds the certificates
+// used to verify the peer, the system roots are used by a client if it is empty.
+// CertFile and KeyFile are the certificate presented to the peer: required for a
+// server, optional for a client. ServerName is the name the client expects in the
+// provider certificate. ClientAuth makes a server require and verify a client
+// certificate signed by CAFile (mutual TLS).
+type TLSOptions struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+	ClientAuth bool
+}
+
+func (o *TLSOptions) loadCA() (*x509.CertPool, errors.Error) {
+	if o.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(o.CAFile)
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("No certificate found in %s.", o.CAFile)
+	}
+	return pool, nil
+}
+
+func (o *TLSOptions) loadCertificates() ([]tls.Certificate, errors.Error) {
+	if o.CertFile == "" && o.KeyFile == "" {
+		return nil, nil
+	}
+	certificate, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	return []tls.Certificate{certificate}, nil
+}
+
+// ClientConfig builds the configuration of a consumer.
+func (o *TLSOptions) ClientConfig() (*tls.Config, errors.Error) {
+	pool, err := o.loadCA()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	certificates, err := o.loadCertificates()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	return &tls.Config{
+		RootCAs:      pool,
+		Certificates: certificates,
+		ServerName:   o.ServerName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ServerConfig builds the configuration of a provider.
+func (o *TLSOptions) ServerConfig() (*tls.Config, errors.Error) {
+	certificates, err := o.loadCertificates()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("A server requires a certificate and a key.")
+	}
+	pool, err := o.loadCA()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	config := &tls.Config{Certificates: certificates, MinVersion: tls.VersionTLS12}
+	if o.ClientAuth {
+		if pool == nil {
+			return nil, errors.New("Client authentication requires a CA file.")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// TLSTransport connects with TLS over TCP. The server name defaults to the host
+// of the address.
+type TLSTransport struct {
+	TCPTransport
+	Config *tls.Config
+}
+
+func NewTLSTransport(address string, port uint16, config *tls.Config) *TLSTransport {
+	return &TLSTransport{TCPTransport: *NewTCPTransport(address, port), Config: config}
+}
+
+func (t *TLSTransport) Open() (io.ReadWriteCloser, errors.Error) {
+	dialer, err := t.dialer()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	conn, e := tls.DialWithDialer(dialer, "tcp", t.Address, t.Config)
+	if e != nil {
+		return nil, errors.NewError(e)
+	}
+	return conn, nil
+}
+
+func (t *TLSTransport) String() string {
+	return "tls:" + t.Address
+}
+
+// ConnectTLS connects to the provider with TLS.
+func (s *S101Client) ConnectTLS(address string, port uint16, config *tls.Config) errors.Error {
+	return s.ConnectTransport(NewTLSTransport(address, port, config))
+}
+
+// ListenTLS accepts consumers with TLS. Set config.ClientAuth to authenticate them.
+func (s *S101Server) ListenTLS(address string, port uint16, config *tls.Config) errors.Error {
+	listener, e := tls.Listen("tcp", net.JoinHostPort(address, fmt.Sprint(port)), config)
+	if e != nil {
+		return errors.NewError(e)
+	}
+	err := s.Serve(listener)
+	if err != nil {
+		listener.Close()
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package socket_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// writeCertificate creates a certificate signed by parent, or self signed if parent
+// is nil, and writes it with its key in dir.
+func writeCertificate(t *testing.T, dir string, name string, parent *testCertificate, serial int64) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer := &testCertificate{certificate: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.certificate, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	if os.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600) != nil ||
+		os.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600) != nil {
+		t.Fatal("Can't write certificate")
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func startTLSServer(t *testing.T, options *socket.TLSOptions) (*socket.S101Server, uint16) {
+	config, err := options.ServerConfig()
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	server := socket.NewS101Server(newTestProviderTree())
+	err = server.ListenTLS("127.0.0.1", 0, config)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	return server, uint16(server.Addr().(*net.TCPAddr).Port)
+}
+
+// connectTLS returns an error if the connection or a GetDirectory fails.
+func connectTLS(t *testing.T, port uint16, options *socket.TLSOptions) error {
+	config, err := options.ClientConfig()
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	client := socket.NewS101Client()
+	err = client.ConnectTLS("127.0.0.1", port, config)
+	if err != nil {
+		return err.Message
+	}
+	defer client.Disconnect()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 2})
+	if err != nil {
+		return err.Message
+	}
+	return nil
+}
+
+func TestTLS(t *testing.T) {
+	dir, e := os.MkdirTemp("", "emberlib")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	ca := writeCertificate(t, dir, "ca", nil, 1)
+	writeCertificate(t, dir, "provider", ca, 2)
+	writeCertificate(t, dir, "consumer", ca, 3)
+	writeCertificate(t, dir, "other", nil, 4)
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	server, port := startTLSServer(t, &socket.TLSOptions{CertFile: file("provider.pem"), KeyFile: file("provider.key")})
+	defer server.Close()
+	err := connectTLS(t, port, &socket.TLSOptions{CAFile: file("ca.pem"), ServerName: "provider"})
+	if err != nil {
+		t.Errorf("TLS connection failed. %s", err)
+	}
+	err = connectTLS(t, port, &socket.TLSOptions{CAFile: file("other.pem"), ServerName: "provider"})
+	if err == nil {
+		t.Errorf("Expected error with an unknown CA")
+	}
+	err = connectTLS(t, port, &socket.TLSOptions{CAFile: file("ca.pem"), ServerName: "wrong"})
+	if err == nil {
+		t.Errorf("Expected error with a wrong server name")
+	}
+
+	mutual, mutualPort := startTLSServer(t, &socket.TLSOptions{CAFile: file("ca.pem"), CertFile: file("provider.pem"), KeyFile: file("provider.key"), ClientAuth: true})
+	defer mutual.Close()
+	err = connectTLS(t, mutualPort, &socket.TLSOptions{CAFile: file("ca.pem"), CertFile: file("consumer.pem"), KeyFile: file("consumer.key")})
+	if err != nil {
+		t.Errorf("Mutual TLS connection failed. %s", err)
+	}
+	err = connectTLS(t, mutualPort, &socket.TLSOptions{CAFile: file("ca.pem")})
+	if err == nil {
+		t.Errorf("Expected error without client certificate")
+	}
+	err = connectTLS(t, mutualPort, &socket.TLSOptions{CAFile: file("ca.pem"), CertFile: file("other.pem"), KeyFile: file("other.key")})
+	if err == nil {
+		t.Errorf("Expected error with an untrusted client certificate")
+	}
+	_, configErr := (&socket.TLSOptions{ClientAuth: true, CertFile: file("provider.pem"), KeyFile: file("provider.key")}).ServerConfig()
+	if configErr == nil {
+		t.Errorf("Expected error requiring client authentication without CA")
+	}
+}
@@ -0,0 +1,135 @@
+package socket
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dufourgilles/emberlib/errors"
+)
+
+// Transport opens the byte stream carrying the S101 frames. The client opens it
+// again when reconnecting.
+type Transport interface {
+	Open() (io.ReadWriteCloser, errors.Error)
+	String() string
+}
+
+// TCPTransport connects to Address (host:port). Timeout limits the time to
+// connect and LocalAddress, if set, is the local ip[:port] to bind to.
+type TCPTransport struct {
+	Address      string
+	Timeout      time.Duration
+	LocalAddress string
+}
+
+func NewTCPTransport(address string, port uint16) *TCPTransport {
+	return &TCPTransport{Address: net.JoinHostPort(address, strconv.Itoa(int(port)))}
+}
+
+func (t *TCPTransport) Open() (io.ReadWriteCloser, errors.Error) {
+	dialer, err := t.dialer()
+	if err != nil {
+		return nil, errors.Update(err)
+	}
+	conn, e := dialer.Dial("tcp", t.Address)
+	if e != nil {
+		return nil, errors.NewError(e)
+	}
+	return conn, nil
+}
+
+func (t *TCPTransport) dialer() (*net.Dialer, errors.Error) {
+	dialer := &net.Dialer{Timeout: t.Timeout}
+	if t.LocalAddress != "" {
+		local := t.LocalAddress
+		if _, _, err := net.SplitHostPort(local); err != nil {
+			local = net.JoinHostPort(local, "0")
+		}
+		addr, err := net.ResolveTCPAddr("tcp", local)
+		if err != nil {
+			return nil, errors.NewError(err)
+		}
+		dialer.LocalAddr = addr
+	}
+	return dialer, nil
+}
+
+func (t *TCPTransport) String() string {
+	return t.Address
+}
+
+// UnixTransport connects to the Unix domain socket at Path.
+type UnixTransport struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func NewUnixTransport(path string) *UnixTransport {
+	return &UnixTransport{Path: path}
+}
+
+func (t *UnixTransport) Open() (io.ReadWriteCloser, errors.Error) {
+	conn, err := net.DialTimeout("unix", t.Path, t.Timeout)
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	return conn, nil
+}
+
+func (t *UnixTransport) String() string {
+	return "unix:" + t.Path
+}
+
+// StreamTransport opens its stream with a function. It carries S101 over any
+// byte pipe, like a serial line.
+type StreamTransport struct {
+	name string
+	open func() (io.ReadWriteCloser, error)
+}
+
+func NewStreamTransport(name string, open func() (io.ReadWriteCloser, error)) *StreamTransport {
+	return &StreamTransport{name: name, open: open}
+}
+
+// NewSerialTransport opens the device file of a serial port (/dev/ttyUSB0). The
+// line settings (baud rate, parity) must have been configured beforehand.
+func NewSerialTransport(device string) *StreamTransport {
+	return NewStreamTransport(device, func() (io.ReadWriteCloser, error) {
+		return os.OpenFile(device, os.O_RDWR, 0)
+	})
+}
+
+func (t *StreamTransport) Open() (io.ReadWriteCloser, errors.Error) {
+	stream, err := t.open()
+	if err != nil {
+		return nil, errors.NewError(err)
+	}
+	return stream, nil
+}
+
+func (t *StreamTransport) String() string {
+	return t.name
+}
+
+// connection is an open stream and the channel closed with it.
+type connection struct {
+	stream io.ReadWriteCloser
+	done   chan struct{}
+}
+
+// countingReader updates the receive statistics.
+type countingReader struct {
+	reader io.Reader
+	update func(n int)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.update(n)
+	}
+	return n, err
+}
@@ -0,0 +1,113 @@
+package socket_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dufourgilles/emberlib/asn1"
+	"github.com/dufourgilles/emberlib/socket"
+)
+
+func checkGetDirectory(t *testing.T, client *socket.S101Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := client.GetDirectoryContext(ctx, asn1.RelativeOID{1, 2})
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+}
+
+func TestConnectStream(t *testing.T) {
+	server := socket.NewS101Server(newTestProviderTree())
+	consumerEnd, providerEnd := net.Pipe()
+	server.ServeStream(providerEnd)
+	defer server.Close()
+	client := socket.NewS101Client()
+	err := client.ConnectStream(consumerEnd)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	checkGetDirectory(t, client)
+}
+
+func TestUnixTransport(t *testing.T) {
+	dir, e := os.MkdirTemp("", "emberlib")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "provider.sock")
+	listener, e := net.Listen("unix", path)
+	if e != nil {
+		t.Skip("Unix domain sockets not supported.", e)
+	}
+	server := socket.NewS101Server(newTestProviderTree())
+	err := server.Serve(listener)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer server.Close()
+	client := socket.NewS101Client()
+	err = client.ConnectTransport(socket.NewUnixTransport(path))
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	checkGetDirectory(t, client)
+}
+
+func TestTCPTransportLocalAddress(t *testing.T) {
+	server, port := startTestServer(t, newTestProviderTree())
+	defer server.Close()
+	transport := socket.NewTCPTransport("127.0.0.1", port)
+	transport.Timeout = time.Second
+	transport.LocalAddress = "127.0.0.1"
+	client := socket.NewS101Client()
+	err := client.ConnectTransport(transport)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	checkGetDirectory(t, client)
+	transport.LocalAddress = "invalid address"
+	err = socket.NewS101Client().ConnectTransport(transport)
+	if err == nil {
+		t.Errorf("Expected error binding to an invalid local address")
+	}
+}
+
+func TestStreamTransportReconnect(t *testing.T) {
+	server := socket.NewS101Server(newTestProviderTree())
+	defer server.Close()
+	var opened int32
+	transport := socket.NewStreamTransport("pipe", func() (io.ReadWriteCloser, error) {
+		atomic.AddInt32(&opened, 1)
+		consumerEnd, providerEnd := net.Pipe()
+		server.ServeStream(providerEnd)
+		return consumerEnd, nil
+	})
+	client := socket.NewS101Client()
+	client.SetReconnectPolicy(&socket.ReconnectPolicy{InitialDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, Multiplier: 2})
+	err := client.ConnectTransport(transport)
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	defer client.Disconnect()
+	checkGetDirectory(t, client)
+	server.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&opened) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&opened) != 2 {
+		t.Fatal("Transport not reopened")
+	}
+	checkGetDirectory(t, client)
+}